@@ -0,0 +1,136 @@
+// Package adapt connects jacl comparisons to the Gomega and testify
+// testing libraries. It depends on neither: the Gomega matcher and
+// the testify-style assertions satisfy those libraries' interfaces.
+package adapt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hackborn/jacl"
+)
+
+// ------------------------------------------------------------
+// GOMEGA
+
+// Match answers a Gomega matcher that succeeds when the actual value
+// satisfies want, for example Expect(resp).To(adapt.Match(jacl.F("id", 1))).
+// want and opts are as jacl.ToCmper().
+func Match(want interface{}, opts ...interface{}) *GomegaMatcher {
+	return &GomegaMatcher{Cmper: jacl.ToCmper(want, opts...)}
+}
+
+// MatchSlice answers a Gomega matcher that compares with
+// jacl.Cmps(want...).
+func MatchSlice(want ...interface{}) *GomegaMatcher {
+	return &GomegaMatcher{Cmper: jacl.Cmps(want...)}
+}
+
+// GomegaMatcher implements Gomega's types.GomegaMatcher with a Cmper.
+type GomegaMatcher struct {
+	Cmper jacl.Cmper
+	// The result of the last Match().
+	err error
+}
+
+// Match answers true if actual satisfies the Cmper. Comparison
+// failures answer false; evaluation failures answer an error.
+func (m *GomegaMatcher) Match(actual interface{}) (bool, error) {
+	m.err = m.Cmper.Cmp(actual)
+	if m.err == nil {
+		return true, nil
+	}
+	var ce *jacl.ComparisonError
+	if errors.As(m.err, &ce) {
+		return false, nil
+	}
+	return false, m.err
+}
+
+// FailureMessage describes why actual did not match.
+func (m *GomegaMatcher) FailureMessage(actual interface{}) string {
+	msg := ""
+	if m.err != nil {
+		msg = "\n" + jacl.FailureMessage(m.err)
+	}
+	return fmt.Sprintf("Expected\n\t%v\nto match the expectation%v", describe(actual), msg)
+}
+
+// NegatedFailureMessage describes why actual should not have matched.
+func (m *GomegaMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n\t%v\nnot to match the expectation", describe(actual))
+}
+
+// ------------------------------------------------------------
+// TESTIFY
+
+// TestingT is the interface used by the testify-style assertions.
+// It matches testify's assert.TestingT, and is satisfied by *testing.T.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Matches asserts that got satisfies want, in the style of testify's
+// assert functions: It reports failures with t.Errorf and answers true
+// on success. want is a Cmper, or an item that is compared with
+// jacl.Cmp(want). msgAndArgs is an optional message or format and
+// arguments that are added to the failure.
+func Matches(t TestingT, want, got interface{}, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	return report(t, jacl.ToCmper(want).Cmp(got), msgAndArgs)
+}
+
+// MatchesSlice is Matches for jacl.Cmps(want...).
+func MatchesSlice(t TestingT, want []interface{}, got interface{}, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	return report(t, jacl.Cmps(want...).Cmp(got), msgAndArgs)
+}
+
+func report(t TestingT, err error, msgAndArgs []interface{}) bool {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	if err == nil {
+		return true
+	}
+	msg := jacl.FailureMessage(err)
+	if len(msgAndArgs) > 0 {
+		msg += "\nmessages: " + messageFromMsgAndArgs(msgAndArgs)
+	}
+	t.Errorf("%v", msg)
+	return false
+}
+
+// helper is implemented by testing.TB, and lets failures
+// point at the caller.
+type helper interface {
+	Helper()
+}
+
+// messageFromMsgAndArgs() formats a testify-style message.
+func messageFromMsgAndArgs(msgAndArgs []interface{}) string {
+	if len(msgAndArgs) == 1 {
+		return fmt.Sprintf("%v", msgAndArgs[0])
+	}
+	if format, ok := msgAndArgs[0].(string); ok {
+		return fmt.Sprintf(format, msgAndArgs[1:]...)
+	}
+	return fmt.Sprint(msgAndArgs...)
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// describe() answers actual as JSON, if possible.
+func describe(actual interface{}) string {
+	b, err := json.Marshal(actual)
+	if err != nil {
+		return fmt.Sprintf("%v", actual)
+	}
+	return string(b)
+}
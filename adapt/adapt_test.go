@@ -0,0 +1,103 @@
+package adapt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hackborn/jacl"
+)
+
+// ------------------------------------------------------------
+// TEST-GOMEGA-MATCHER
+
+func TestGomegaMatcher(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	cases := []struct {
+		Matcher    *GomegaMatcher
+		Actual     interface{}
+		WantOk     bool
+		WantErr    bool
+		WantPrefix string
+	}{
+		{Match(jacl.F("a", "a")), jacl.F("a", "a", "b", "b"), true, false, ""},
+		{Match(jacl.F("a", "a")), jacl.F("a", "b"), false, false, "Expected\n\t{\"a\":\"b\"}\nto match the expectation\njacl: comparison failed with 1 mismatch(es):\n\ta: have \"b\" want \"a\""},
+		{Match(jacl.F("a", 1), jacl.Tolerance(0.1, 0)), jacl.F("a", 1.05), true, false, ""},
+		{Match(jacl.CmpNil()), nil, true, false, ""},
+		{Match(jacl.CmpNil()), "a", false, false, ""},
+		{Match(jacl.Cmps(jacl.F("a", "x"), jacl.F("a", "y")), jacl.AllErrors()), []interface{}{jacl.F("a", "a"), jacl.F("a", "b")}, false, false, "Expected\n\t[{\"a\":\"a\"},{\"a\":\"b\"}]\nto match the expectation\njacl: comparison failed with 2 mismatch(es):"},
+		{MatchSlice(jacl.Key("a"), jacl.F("a", "a")), []interface{}{jacl.F("a", "b"), jacl.F("a", "a")}, true, false, ""},
+		{MatchSlice(jacl.SizeIs(2)), []interface{}{jacl.F("a", "b")}, false, false, ""},
+		{Match(jacl.F("a", "a")), func() {}, false, true, ""},
+	}
+	for i, tc := range cases {
+		if !jacl.WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveOk, haveErr := tc.Matcher.Match(tc.Actual)
+			if haveOk != tc.WantOk {
+				fmt.Printf("have ok %v want %v\n", haveOk, tc.WantOk)
+				t.Fatal()
+			} else if (haveErr != nil) != tc.WantErr {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			} else if !strings.HasPrefix(tc.Matcher.FailureMessage(tc.Actual), tc.WantPrefix) {
+				fmt.Printf("have msg %v want %v\n", tc.Matcher.FailureMessage(tc.Actual), tc.WantPrefix)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-TESTIFY
+
+func TestTestify(t *testing.T) {
+	cases := []struct {
+		Fn      func(TestingT) bool
+		WantOk  bool
+		WantMsg string
+	}{
+		{func(t TestingT) bool { return Matches(t, jacl.F("a", "a"), jacl.F("a", "a")) }, true, ""},
+		{func(t TestingT) bool { return Matches(t, jacl.F("a", "a"), jacl.F("a", "b")) }, false, ""},
+		{func(t TestingT) bool { return Matches(t, jacl.Cmp(jacl.F("a", "a")), jacl.F("a", "a")) }, true, ""},
+		{func(t TestingT) bool {
+			return Matches(t, jacl.F("a", "a"), jacl.F("a", "b"), "user %v", 1)
+		}, false, "messages: user 1"},
+		{func(t TestingT) bool {
+			return MatchesSlice(t, []interface{}{jacl.NotExists("b")}, []interface{}{jacl.F("a", "a")})
+		}, true, ""},
+		{func(t TestingT) bool {
+			return MatchesSlice(t, []interface{}{jacl.NotExists("b")}, []interface{}{jacl.F("b", "a")}, "no b")
+		}, false, "messages: no b"},
+	}
+	for i, tc := range cases {
+		if !jacl.WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			ft := &fakeT{}
+			haveOk := tc.Fn(ft)
+			if haveOk != tc.WantOk || haveOk == (ft.msg != "") {
+				fmt.Printf("have ok %v want %v (msg %v)\n", haveOk, tc.WantOk, ft.msg)
+				t.Fatal()
+			} else if !strings.Contains(ft.msg, tc.WantMsg) {
+				fmt.Printf("have msg %v want %v\n", ft.msg, tc.WantMsg)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// fakeT records failures instead of reporting them.
+type fakeT struct {
+	msg string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.msg = fmt.Sprintf(format, args...)
+}
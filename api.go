@@ -1,5 +1,12 @@
 package jacl
 
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
 // A Cmper compares the values of two types.
 type Cmper interface {
 	// Answer nil if b contains all the values of a,
@@ -18,21 +25,44 @@ type Cmper interface {
 // Cmp constructs a new comparison object. It can be used
 // against a single item. The item must resolve to a map
 // of string -> interface{}.
-func Cmp(a interface{}) Cmper {
-	return singleCmp{A: a}
+//
+// Options, such as AllErrors(), can follow the item. So can the
+// cmps funcs that apply to individual items, such as NotExists()
+// and SizeIs(): The funcs treat the result as a list of one item,
+// so paths are relative to the result. If the result is a list,
+// the funcs apply to it as they would in Cmps(). See below.
+func Cmp(a interface{}, opts ...interface{}) Cmper {
+	c := singleCmp{A: a}
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case option:
+			ot.applyTo(&c.Opts)
+		case keyFn, *keyFn:
+			panic(fmt.Errorf("jacl: Key() requires Cmps()"))
+		case CmpsFunc:
+			c.Fn = append(c.Fn, FuncFactory{Fn: ot})
+		default:
+			panic(fmt.Errorf("unknown option %T", o))
+		}
+	}
+	return c
 }
 
 // Cmps constructs a new comparison object to be used against a
 // slice of items. Each item in the slice must resolve
 // to a map of string -> interface{}.
 //
-// Additional functionality is available via cmps funcs. See below.
+// Additional functionality is available via cmps funcs and
+// options. See below.
 func Cmps(_a ...interface{}) Cmper {
 	var key []string
 	var a []interface{}
 	var fn []FuncFactory
+	var opts cmpOpts
 	for _, ai := range _a {
 		switch ait := ai.(type) {
+		case option:
+			ait.applyTo(&opts)
 		case keyFn:
 			key = ait.Keys
 		case *keyFn:
@@ -43,7 +73,31 @@ func Cmps(_a ...interface{}) Cmper {
 			a = append(a, ai)
 		}
 	}
-	return sliceCmp{Keys: key, A: a, Fn: fn}
+	return sliceCmp{Keys: key, A: a, Fn: fn, Opts: opts}
+}
+
+// ToCmper answers want as a Cmper. want is a Cmper, or an item
+// that is compared with Cmp(want, opts...). Options, such as
+// AllErrors(), are applied to a Cmper made by Cmp() or Cmps().
+// ToCmper panics if opts are passed with any other Cmper, or if
+// they include anything but options.
+func ToCmper(want interface{}, opts ...interface{}) Cmper {
+	c, ok := want.(Cmper)
+	if !ok {
+		return Cmp(want, opts...)
+	}
+	if len(opts) < 1 {
+		return c
+	}
+	switch ct := c.(type) {
+	case singleCmp:
+		applyOptions(&ct.Opts, opts)
+		return ct
+	case sliceCmp:
+		applyOptions(&ct.Opts, opts)
+		return ct
+	}
+	panic(fmt.Errorf("jacl: options can't be applied to %T, only to Cmp() and Cmps()", c))
 }
 
 // CmpNil constructs a new comparison object that fails
@@ -53,6 +107,131 @@ func CmpNil() Cmper {
 	return nilCmp{}
 }
 
+// HTTP constructs a new comparison object for an *http.Response, or
+// a recorder such as *httptest.ResponseRecorder. Each part is optional:
+// A status of 0 is not compared, headers are compared by name and
+// can contain matchers, and a nil body is not compared. A header
+// list is compared to all of the header's values, anything else must
+// match one value. Numbers and bools are compared to the header text
+// as numbers and bools, and IsMissing() matches an absent header. The body is
+// decoded according to its Content-Type before it is compared, so
+// any Cmper can be used, such as Cmp() for an object or Cmps() for a
+// list. Mismatches are reported at paths starting with status,
+// header or body.
+func HTTP(status int, headers Fields, body Cmper) Cmper {
+	return httpCmp{Status: status, Headers: headers, Body: CmperFactory{Cmper: body}}
+}
+
+// At constructs a new comparison object for part of the result.
+// The path selects the part, and cmp compares it. The path is a
+// JSON Pointer such as /data/items/0, or a JSONPath such as
+// $.data.items[*]. JSONPath supports .name, ['name'], [n] with
+// negative indexes counting from the end, and the wildcards .* and
+// [*]. A path with a wildcard selects a list, so it is compared with
+// Cmps(). The comparison can't be performed if any step of the path
+// can't be followed. Mismatches are reported at their path in the
+// whole result. At panics if the path is invalid.
+func At(path string, cmp Cmper) Cmper {
+	if _, _, err := parseSelectPath(path); err != nil {
+		panic(err)
+	}
+	return atCmp{Path: path, Inner: CmperFactory{Cmper: cmp}}
+}
+
+// Schema constructs a new comparison object that validates the result
+// against a JSON Schema. The supported subset of draft 2020-12 is the
+// type, enum, const, required, properties, additionalProperties,
+// items, pattern, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minLength, maxLength, minItems and maxItems
+// keywords, and boolean schemas. Other keywords are ignored. Patterns
+// use Go regular expression syntax.
+//
+// Every violation is reported in the ComparisonError, with a JSON
+// Pointer path and ReasonSchema. Schema panics if the schema is
+// invalid.
+func Schema(schemaJSON []byte) Cmper {
+	root, err := compileSchema(schemaJSON)
+	if err != nil {
+		panic(err)
+	}
+	return schemaCmp{Schema: schemaJSON, root: root}
+}
+
+// GoldenOpts configures a golden file comparison.
+type GoldenOpts struct {
+	// Prune limits updates to the fields already in the golden file.
+	Prune bool
+	// Update writes the golden file, even without JACL_UPDATE.
+	Update bool
+	// Options for the comparison, as passed to Cmp().
+	Options []interface{}
+}
+
+// Golden constructs a new comparison object backed by a golden file.
+// The contents of the file are compared to the item using the same
+// rules as Cmp(). Plain file names are placed in ./testdata, the same
+// directory WantTest() uses.
+//
+// When the JACL_UPDATE environment variable is true, the item is
+// written to the file instead of being compared, creating it if needed.
+func Golden(filename string) Cmper {
+	return GoldenWith(filename, GoldenOpts{})
+}
+
+// GoldenWith constructs a new golden file comparison with options.
+// See Golden().
+func GoldenWith(filename string, opts GoldenOpts) Cmper {
+	c := goldenCmp{Filename: filename, Prune: opts.Prune, Update: opts.Update}
+	applyOptions(&c.Opts, opts.Options)
+	return c
+}
+
+// ------------------------------------------------------------
+// COMBINATORS
+
+// All constructs a comparison that passes if every Cmper passes.
+// Each Cmper is run, and the error has an entry for each in
+// ComparisonError.Branches().
+func All(cmps ...Cmper) Cmper {
+	return allCmp{Cmps: toCmperFactories(cmps)}
+}
+
+// AnyOf constructs a comparison that passes if at least one Cmper
+// passes. A Cmper that can't perform its comparison, such as an At()
+// with a path that doesn't resolve, counts as failing. When they all
+// fail, the error has an entry for each in ComparisonError.Branches().
+func AnyOf(cmps ...Cmper) Cmper {
+	return anyOfCmp{Cmps: toCmperFactories(cmps)}
+}
+
+// Not constructs a comparison that passes if the Cmper fails.
+// An EvaluationError from the Cmper is answered as-is, since
+// whether it would pass is unknown.
+func Not(cmp Cmper) Cmper {
+	return notCmp{Inner: CmperFactory{Cmper: cmp}}
+}
+
+// ------------------------------------------------------------
+// INPUTS
+
+// JSON wraps JSON text so it can be used as either side of a
+// comparison, instead of being compared as a byte slice. Invalid JSON
+// fails the comparison with an EvaluationError. A json.RawMessage
+// is treated the same way without needing to be wrapped.
+func JSON(data []byte) interface{} {
+	return jsonInput{data: data}
+}
+
+// Reader reads JSON text from r so it can be used as either side of
+// a comparison. See JSON().
+func Reader(r io.Reader) interface{} {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return jsonInput{err: fmt.Errorf("jacl: reading JSON input: %w", err)}
+	}
+	return jsonInput{data: data}
+}
+
 // ------------------------------------------------------------
 // CMPS FUNCS
 
@@ -60,19 +239,225 @@ func CmpNil() Cmper {
 // matching function: It defines what keys are used to determine identity
 // between the two slices being compared. This can be used to compare
 // slices of unequal size, or slices in different orders.
+//
+// Each key is a path to a field, either dotted (owner.id) or a JSON
+// Pointer (/owner/id). A field named by the whole key, such as a
+// literal "owner.id", takes precedence over the path. Key values are
+// compared like any other value, including Tolerance(), so they can
+// be objects or matchers. An element whose keys match more than one
+// element of the result fails with ReasonAmbiguous.
 func Key(v ...string) interface{} {
 	return &keyFn{Keys: v}
 }
 
+// Unordered can be passed as one of the values to Cmps(), or to Cmp().
+// It matches each expected element to a distinct element of the result
+// by content alone, so neither order nor a Key() is needed. The list
+// passed to Cmps() may have more elements than expected. It also
+// applies to slices nested inside the compared values, which must be
+// the same length, as they are without this option. Expected elements
+// without a partner are reported at their index in the expectation.
+func Unordered() interface{} {
+	return unorderedOpt{}
+}
+
 // NotExists constructs a not exists comparison: The comparison will fail
 // if the supplied field exists in the result. You can match against
 // hierarchical results by supplying a path down to the desired field.
+// Array indexes in the path are written as numbers, such as "0".
+// It can be passed to Cmp() or Cmps().
 func NotExists(path ...string) interface{} {
 	return &notExistsFn{Path: path}
 }
 
 // SizeIs can be passed as one of the values to Cmps(). It is a special
 // comparison function: Error if the result size does not match.
-func SizeIs(size int) interface{} {
-	return &sizeisFn{Size: size}
+// With a path, it is the size of the array at that path in each item
+// of the result that must match. The path is a list of field names.
+func SizeIs(size int, path ...string) interface{} {
+	return &sizeisFn{Size: size, Path: path}
+}
+
+// Each can be passed as one of the values to Cmps(). It is a special
+// comparison function: Error if any item in the result fails cmp,
+// reporting the mismatches of each failing item.
+func Each(cmp Cmper) interface{} {
+	return &eachFn{Cmp: CmperFactory{Cmper: cmp}}
+}
+
+// None can be passed as one of the values to Cmps(). It is a special
+// comparison function: Error if any item in the result passes cmp,
+// reporting each passing item.
+func None(cmp Cmper) interface{} {
+	return &noneFn{Cmp: CmperFactory{Cmper: cmp}}
+}
+
+// AtLeast can be passed as one of the values to Cmps(). It is a special
+// comparison function: Error if fewer than n items in the result pass
+// cmp, reporting the items that failed.
+func AtLeast(n int, cmp Cmper) interface{} {
+	return newCountFn(n, true, false, cmp)
+}
+
+// AtMost can be passed as one of the values to Cmps(). It is a special
+// comparison function: Error if more than n items in the result pass
+// cmp, reporting the items that passed.
+func AtMost(n int, cmp Cmper) interface{} {
+	return newCountFn(n, false, true, cmp)
+}
+
+// Exactly can be passed as one of the values to Cmps(). It is a special
+// comparison function: Error unless exactly n items in the result pass
+// cmp, reporting the items that failed or passed, whichever is wrong.
+func Exactly(n int, cmp Cmper) interface{} {
+	return newCountFn(n, true, true, cmp)
+}
+
+// newCountFn() answers a new count function bounded by n,
+// panicking on a negative count.
+func newCountFn(n int, atLeast, atMost bool, cmp Cmper) *countFn {
+	if n < 0 {
+		panic(fmt.Errorf("jacl: negative count %v", n))
+	}
+	f := &countFn{Max: -1, Cmp: CmperFactory{Cmper: cmp}}
+	if atLeast {
+		f.Min = n
+	}
+	if atMost {
+		f.Max = n
+	}
+	return f
+}
+
+// ------------------------------------------------------------
+// MATCHERS
+
+// Any matches any value. The field must still exist in the result.
+func Any() Matcher {
+	return anyMatcher{}
+}
+
+// Regex matches strings against a regular expression. It panics
+// if the pattern does not compile.
+func Regex(pattern string) Matcher {
+	return regexMatcher{Pattern: pattern, re: regexp.MustCompile(pattern)}
+}
+
+// OneOf matches any one of the supplied values.
+func OneOf(values ...interface{}) Matcher {
+	return oneOfMatcher{Values: values}
+}
+
+// Range matches numbers between min and max, inclusive.
+func Range(min, max float64) Matcher {
+	return rangeMatcher{Min: floatNumber(min), Max: floatNumber(max)}
+}
+
+// Approx matches numbers equal to value within either the absolute
+// or relative tolerance. This overrides any Tolerance() option.
+func Approx(value, abs, rel float64) Matcher {
+	return approxMatcher{Value: value, Abs: abs, Rel: rel}
+}
+
+// Prefix matches strings that start with prefix.
+func Prefix(prefix string) Matcher {
+	return prefixMatcher{Prefix: prefix}
+}
+
+// Suffix matches strings that end with suffix.
+func Suffix(suffix string) Matcher {
+	return suffixMatcher{Suffix: suffix}
+}
+
+// Contains matches strings that contain substr.
+func Contains(substr string) Matcher {
+	return containsMatcher{Substr: substr}
+}
+
+// NotEmpty matches anything but null and empty strings, arrays
+// and objects.
+func NotEmpty() Matcher {
+	return notEmptyMatcher{}
+}
+
+// TypeIs matches values of a JSON type, one of TypeNull, TypeBool,
+// TypeNumber, TypeString, TypeArray or TypeObject.
+func TypeIs(t string) Matcher {
+	if err := checkJsonType(t); err != nil {
+		panic(err)
+	}
+	return typeIsMatcher{Type: t}
+}
+
+// IsNull matches a value that exists and is null. A plain nil in
+// the expectation means the same thing.
+func IsNull() Matcher {
+	return presenceMatcher{Null: true}
+}
+
+// IsMissing matches a field that is absent. A field that is present,
+// even with a null value, fails with ReasonExists.
+func IsMissing() Matcher {
+	return presenceMatcher{Missing: true}
+}
+
+// IsNullOrMissing matches a field that is absent, or that is null.
+func IsNullOrMissing() Matcher {
+	return presenceMatcher{Null: true, Missing: true}
+}
+
+// Capture matches any value, storing it under name in the Vars
+// passed to Cmp() or Cmps() once the comparison passes. It fails
+// if the comparison has no Vars.
+func Capture(name string) Matcher {
+	return captureMatcher{Name: name}
+}
+
+// Ref matches a value equal to the one stored under name in the
+// Vars passed to Cmp() or Cmps(), or captured earlier in the same
+// comparison. It can be used in Key() values to find an item by a
+// captured id. It fails if nothing has been stored under name.
+func Ref(name string) Matcher {
+	return refMatcher{Name: name}
+}
+
+// ------------------------------------------------------------
+// OPTIONS
+
+// AllErrors can be passed to Cmp() or Cmps(). It walks the entire
+// comparison and reports every mismatch, missing field and failed
+// cmps func instead of stopping at the first. The result is still a
+// ComparisonError; use its Mismatches() to examine each one.
+func AllErrors() interface{} {
+	return allErrorsOpt{}
+}
+
+// Tolerance can be passed to Cmp() or Cmps(). Numbers are considered
+// equal if they differ by no more than the absolute tolerance, or by
+// no more than the relative tolerance scaled by the larger magnitude.
+// Integers are otherwise compared exactly, at any size.
+func Tolerance(abs, rel float64) interface{} {
+	return toleranceOpt{Abs: abs, Rel: rel}
+}
+
+// Strict can be passed to Cmp() or Cmps(). It makes the comparison
+// symmetric: In addition to the normal rules, it fails on keys in the
+// result that are not expected, and on extra elements in slices. The
+// open paths are left asymmetric, along with everything below them.
+// Paths are written the same way ComparisonError reports them, for
+// example "metadata" or "items[*].labels", where [*] matches any index.
+func Strict(open ...string) interface{} {
+	return strictOpt{Open: open}
+}
+
+// IncludeZero can be passed to Cmp() or Cmps(). Struct fields tagged
+// omitempty are normally dropped when they are zero, so an expectation
+// can't require deleted == false. With this option, zero bools,
+// numbers and strings are kept in both the expected and compared
+// values. Nil pointers, slices and maps are still dropped.
+//
+// For structs you own, a field can be kept regardless of its value
+// by adding a jacl:"required" tag.
+func IncludeZero() interface{} {
+	return includeZeroOpt{}
 }
@@ -0,0 +1,91 @@
+package jacl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ------------------------------------------------------------
+// ASSERT
+
+// Assert compares got against want, reporting any failure with
+// t.Errorf and answering false. want and opts are as ToCmper().
+func Assert(t testing.TB, want, got interface{}, opts ...interface{}) bool {
+	t.Helper()
+	err := ToCmper(want, opts...).Cmp(got)
+	if err != nil {
+		t.Errorf("%v", FailureMessage(err))
+		return false
+	}
+	return true
+}
+
+// Require is Assert, but reports failures with t.Fatalf,
+// ending the test.
+func Require(t testing.TB, want, got interface{}, opts ...interface{}) {
+	t.Helper()
+	err := ToCmper(want, opts...).Cmp(got)
+	if err != nil {
+		t.Fatalf("%v", FailureMessage(err))
+	}
+}
+
+// Asserts compares got against want, reporting any failure with
+// t.Errorf and answering false. want is the list of values passed
+// to Cmps(), so it can include cmps funcs and options.
+func Asserts(t testing.TB, want []interface{}, got interface{}) bool {
+	t.Helper()
+	err := Cmps(want...).Cmp(got)
+	if err != nil {
+		t.Errorf("%v", FailureMessage(err))
+		return false
+	}
+	return true
+}
+
+// Requires is Asserts, but reports failures with t.Fatalf,
+// ending the test.
+func Requires(t testing.TB, want []interface{}, got interface{}) {
+	t.Helper()
+	err := Cmps(want...).Cmp(got)
+	if err != nil {
+		t.Fatalf("%v", FailureMessage(err))
+	}
+}
+
+// FailureMessage answers a test failure message for an error answered
+// by a Cmper. It distinguishes comparison and evaluation errors, and
+// includes each mismatch and a diff when available.
+func FailureMessage(err error) string {
+	var ce *ComparisonError
+	if !errors.As(err, &ce) {
+		return fmt.Sprintf(evaluationFailureFmt, err)
+	}
+	var sb strings.Builder
+	mismatches := ce.Mismatches()
+	fmt.Fprintf(&sb, comparisonFailureFmt, len(mismatches))
+	if ce.attempts > 0 {
+		sb.WriteString("\n\t")
+		fmt.Fprintf(&sb, attemptsFmt, ce.attempts, ce.elapsed.Round(time.Millisecond))
+	}
+	for _, m := range mismatches {
+		sb.WriteString("\n\t")
+		sb.WriteString(m.Error())
+	}
+	if diff := ce.Diff(); diff != "" {
+		sb.WriteString("\ndiff (- want, + have):\n")
+		sb.WriteString(strings.TrimSuffix(diff, "\n"))
+	}
+	return sb.String()
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	comparisonFailureFmt = "jacl: comparison failed with %v mismatch(es):"
+	evaluationFailureFmt = "jacl: comparison could not be performed: %v"
+)
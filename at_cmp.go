@@ -0,0 +1,283 @@
+package jacl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// AT-CMP
+
+// atCmp selects part of B and compares it with another Cmper.
+type atCmp struct {
+	Path  string       `json:"path"`
+	Inner CmperFactory `json:"cmp,omitempty"`
+}
+
+func (c atCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+func (c atCmp) cmpScoped(_b interface{}, sc *varScope) error {
+	sels, multi, err := parseSelectPath(c.Path)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	b, err := normalize(_b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	nodes, err := selectNodes(b, sels)
+	if err != nil {
+		return newEvaluationError(fmt.Errorf("jacl: path %v: %w", c.Path, err))
+	}
+	if c.Inner.Cmper == nil {
+		return nil
+	}
+
+	// A single node is compared directly, a node list as a slice.
+	if !multi {
+		return prefixError(c.Inner.cmpScoped(nodes[0].value, sc), nodes[0].path)
+	}
+	values := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, n.value)
+	}
+	err = c.Inner.cmpScoped(values, sc)
+	var ce *ComparisonError
+	if !errors.As(err, &ce) {
+		return prefixError(err, selectorsPath(sels))
+	}
+	return ce.withPathFunc(func(path string) string {
+		return nodePath(nodes, sels, path)
+	})
+}
+
+func (c atCmp) SerializeKey() string {
+	return atCmpFactoryKey
+}
+
+// nodePath() converts a path into the selected node list to a
+// path into B. Paths that don't start at a node are placed under
+// the selection itself.
+func nodePath(nodes []selectedNode, sels []selector, path string) string {
+	if strings.HasPrefix(path, "[") {
+		if end := strings.Index(path, "]"); end > 0 {
+			i, err := strconv.Atoi(path[1:end])
+			if err == nil && i >= 0 && i < len(nodes) {
+				return nodes[i].path + path[end+1:]
+			}
+		}
+	}
+	return joinPath(selectorsPath(sels), path)
+}
+
+// ------------------------------------------------------------
+// SELECTOR
+
+// selector is a single step of a path.
+type selector struct {
+	kind  selectorKind
+	key   string
+	index int
+}
+
+type selectorKind int
+
+const (
+	selectKey   selectorKind = iota // An object member, or an array index in a JSON Pointer
+	selectIndex                     // An array index, negative counts from the end
+	selectAll                       // Every member or element
+)
+
+// selectedNode is a value selected from a document, along with
+// its location.
+type selectedNode struct {
+	path  string
+	value interface{}
+}
+
+// parseSelectPath() parses a JSONPath or JSON Pointer. It answers
+// the steps, and true if the path can select more than one node.
+//
+// JSONPath is limited to the root $, .name, ['name'], [n] and the
+// wildcards .* and [*]. A JSON Pointer is empty or starts with /.
+func parseSelectPath(path string) ([]selector, bool, error) {
+	if path == "" || strings.HasPrefix(path, "/") {
+		var sels []selector
+		for _, tok := range splitPointer(path) {
+			sels = append(sels, selector{kind: selectKey, key: tok})
+		}
+		return sels, false, nil
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, false, fmt.Errorf(badSelectPathFmt, path, "want $ or /")
+	}
+	var sels []selector
+	multi := false
+	rest := path[1:]
+	for rest != "" {
+		var sel selector
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, false, fmt.Errorf(badSelectPathFmt, path, "recursive descent is not supported")
+		case strings.HasPrefix(rest, ".*"):
+			sel, rest = selector{kind: selectAll}, rest[2:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, false, fmt.Errorf(badSelectPathFmt, path, "empty name")
+			}
+			sel, rest = selector{kind: selectKey, key: rest[1 : end+1]}, rest[end+1:]
+		case strings.HasPrefix(rest, "["):
+			end := bracketEnd(rest)
+			if end < 0 {
+				return nil, false, fmt.Errorf(badSelectPathFmt, path, "unterminated [")
+			}
+			s, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, false, fmt.Errorf(badSelectPathFmt, path, err)
+			}
+			sel, rest = s, rest[end+1:]
+		default:
+			return nil, false, fmt.Errorf(badSelectPathFmt, path, "unexpected "+rest)
+		}
+		if sel.kind == selectAll {
+			multi = true
+		}
+		sels = append(sels, sel)
+	}
+	return sels, multi, nil
+}
+
+// bracketEnd() answers the index of the ] that closes the [ at
+// the start of s, skipping quoted names, or -1.
+func bracketEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == '\\':
+			i++
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote == 0 && (s[i] == '\'' || s[i] == '"'):
+			quote = s[i]
+		case quote == 0 && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBracket() parses the contents of a [] step.
+func parseBracket(s string) (selector, error) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return selector{kind: selectAll}, nil
+	}
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		name := s[1 : len(s)-1]
+		if s[0] == '\'' {
+			name = strings.ReplaceAll(strings.ReplaceAll(name, `\'`, `'`), `"`, `\"`)
+		}
+		key, err := strconv.Unquote(`"` + name + `"`)
+		if err != nil {
+			return selector{}, fmt.Errorf("bad name %v", s)
+		}
+		return selector{kind: selectKey, key: key}, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return selector{}, fmt.Errorf("bad index %v", s)
+	}
+	return selector{kind: selectIndex, index: i}, nil
+}
+
+// selectNodes() answers the nodes in v selected by sels. Every
+// step must be followed, otherwise the path does not resolve.
+func selectNodes(v interface{}, sels []selector) ([]selectedNode, error) {
+	nodes := []selectedNode{{value: v}}
+	for _, sel := range sels {
+		next := make([]selectedNode, 0, len(nodes))
+		for _, n := range nodes {
+			switch sel.kind {
+			case selectAll:
+				switch t := n.value.(type) {
+				case []interface{}:
+					for i, e := range t {
+						next = append(next, selectedNode{joinIndex(n.path, i), e})
+					}
+				case map[string]interface{}:
+					for _, k := range sortedKeys(t) {
+						next = append(next, selectedNode{joinKey(n.path, k), t[k]})
+					}
+				default:
+					return nil, fmt.Errorf(unresolvedFmt, "*", jsonTypeOf(n.value), rootPath(n.path))
+				}
+			case selectIndex:
+				t, ok := n.value.([]interface{})
+				i := sel.index
+				if ok && i < 0 {
+					i += len(t)
+				}
+				if !ok || i < 0 || i >= len(t) {
+					return nil, fmt.Errorf(unresolvedFmt, fmt.Sprintf("[%v]", sel.index), jsonTypeOf(n.value), rootPath(n.path))
+				}
+				next = append(next, selectedNode{joinIndex(n.path, i), t[i]})
+			default:
+				switch t := n.value.(type) {
+				case map[string]interface{}:
+					if e, ok := t[sel.key]; ok {
+						next = append(next, selectedNode{joinKey(n.path, sel.key), e})
+						continue
+					}
+				case []interface{}:
+					if i, err := strconv.Atoi(sel.key); err == nil && i >= 0 && i < len(t) {
+						next = append(next, selectedNode{joinIndex(n.path, i), t[i]})
+						continue
+					}
+				}
+				return nil, fmt.Errorf(unresolvedFmt, strconv.Quote(sel.key), jsonTypeOf(n.value), rootPath(n.path))
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// selectorsPath() answers sels as a path, with [*] for wildcards.
+func selectorsPath(sels []selector) string {
+	path := ""
+	for _, sel := range sels {
+		switch sel.kind {
+		case selectAll:
+			path += "[*]"
+		case selectIndex:
+			path = joinIndex(path, sel.index)
+		default:
+			path = joinKey(path, sel.key)
+		}
+	}
+	return path
+}
+
+// rootPath() answers path, or $ for the root.
+func rootPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	badSelectPathFmt = "jacl: bad path %v: %v"
+	unresolvedFmt    = "can't select %v from %v at %v"
+)
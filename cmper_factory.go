@@ -2,6 +2,7 @@ package jacl
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // ------------------------------------------------------------
@@ -21,13 +22,22 @@ func (f CmperFactory) Cmp(b interface{}) error {
 	return f.Cmper.Cmp(b)
 }
 
+func (f CmperFactory) cmpScoped(b interface{}, sc *varScope) error {
+	if f.Cmper == nil {
+		return nil
+	}
+	return cmpScoped(f.Cmper, b, sc)
+}
+
 // MarshalJSON overrides this struct's marshalling to remove the Fields layer.
 func (f CmperFactory) MarshalJSON() ([]byte, error) {
 	key := ""
 	if f.Cmper != nil {
-		if s, ok := f.Cmper.(serializer); ok {
-			key = s.SerializeKey()
+		s, ok := f.Cmper.(serializer)
+		if !ok {
+			return nil, fmt.Errorf("jacl: %T has no SerializeKey()", f.Cmper)
 		}
+		key = s.SerializeKey()
 	}
 	glue := cmperFactoryGlue{key, f.Cmper}
 	return json.Marshal(glue)
@@ -36,22 +46,26 @@ func (f CmperFactory) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON overrides this struct's unmarshalling to remove the Fields layer.
 func (f *CmperFactory) UnmarshalJSON(data []byte) error {
 	glue := cmperFactoryGlue{}
-	err := json.Unmarshal(data, &glue)
+	err := unmarshalJson(data, &glue)
 	if err != nil {
 		return err
 	}
-	switch glue.Key {
-	case nilCmpFactoryKey:
-		f.Cmper = &nilCmp{}
-	case singleCmpFactoryKey:
-		c := &singleCmp{}
-		err = toFromJson(glue.Cmper, c)
-		f.Cmper = c
-	case sliceCmpFactoryKey:
-		c := &sliceCmp{}
+	f.Cmper = nil
+	if glue.Key == "" {
+		return nil
+	}
+	v, err := newRegistered(glue.Key)
+	if err != nil {
+		return err
+	}
+	c, ok := v.(Cmper)
+	if !ok {
+		return fmt.Errorf("jacl: %v is not a Cmper", glue.Key)
+	}
+	if glue.Cmper != nil {
 		err = toFromJson(glue.Cmper, c)
-		f.Cmper = c
 	}
+	f.Cmper = c
 	return err
 }
 
@@ -64,6 +78,7 @@ type cmperFactoryGlue struct {
 // SERIALIZER
 
 // serializer defines items that can be serialized to a CmperFactory.
+// Custom Cmpers implement it and are made available with Register().
 type serializer interface {
 	// Answer a unique key so I can be reinstantiated after marshalling.
 	SerializeKey() string
@@ -76,4 +91,10 @@ const (
 	nilCmpFactoryKey    = "jacl-nilcmp"
 	singleCmpFactoryKey = "jacl-singlecmp"
 	sliceCmpFactoryKey  = "jacl-slicecmp"
+	goldenCmpFactoryKey = "jacl-goldencmp"
+	httpCmpFactoryKey   = "jacl-httpcmp"
+	atCmpFactoryKey     = "jacl-atcmp"
+	allCmpFactoryKey    = "jacl-allcmp"
+	anyOfCmpFactoryKey  = "jacl-anyofcmp"
+	notCmpFactoryKey    = "jacl-notcmp"
 )
@@ -2,7 +2,11 @@ package jacl
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // ------------------------------------------------------------
@@ -44,68 +48,247 @@ func (f notExistsFn) Eval(resps []interface{}) error {
 	// This is slightly confusing but the functions are designed
 	// against slices, so we need to evaluate against each item
 	// in the slice.
-	for _, resp := range resps {
-		if f.existsI(f.Path, resp, false) {
-			return newComparisonError(fmt.Sprintf("exists: %v", f.Path))
+	s := newCmpState(cmpOpts{All: true})
+	for i, resp := range resps {
+		if v, path, ok := f.existsI(joinIndex("", i), f.Path, resp, false); ok {
+			s.fail(newMismatchError(path, ReasonExists, nil, v))
 		}
 	}
-	return nil
+	return s.err()
 }
 
 func (f notExistsFn) FactoryKey() string {
 	return notExistsFactoryKey
 }
 
-func (f notExistsFn) existsI(needle []string, _haystack interface{}, converted bool) bool {
+// existsI() answers the value at the end of needle, its path
+// below path, and whether it exists.
+func (f notExistsFn) existsI(path string, needle []string, _haystack interface{}, converted bool) (interface{}, string, bool) {
 	if len(needle) < 1 {
-		return false
+		return nil, path, false
 	}
 	switch haystack := _haystack.(type) {
 	case string:
-		return needle[0] == haystack
+		return haystack, joinKey(path, needle[0]), needle[0] == haystack
 	case map[string]interface{}:
 		if v, ok := haystack[needle[0]]; ok {
 			if len(needle) == 1 {
-				return true
+				return v, joinKey(path, needle[0]), true
 			}
-			return f.existsI(needle[1:], v, converted)
+			return f.existsI(joinKey(path, needle[0]), needle[1:], v, converted)
 		} else {
-			return false
+			return nil, path, false
 		}
+	case []interface{}:
+		// Arrays along the path are indexed by position.
+		if i, err := strconv.Atoi(needle[0]); err == nil && i >= 0 && i < len(haystack) {
+			if len(needle) == 1 {
+				return haystack[i], joinIndex(path, i), true
+			}
+			return f.existsI(joinIndex(path, i), needle[1:], haystack[i], true)
+		}
+		return nil, path, false
 	default:
-		// Convert unknown types into a known format
+		// Scalars and nil have no fields. Anything else is converted
+		// into a known format, and a value that can't be converted
+		// has no fields either.
 		if converted {
-			panic("unhandled type")
+			return nil, path, false
 		}
-		m := make(map[string]interface{})
-		err := toFromJson(_haystack, &m)
+		v, err := normalize(_haystack)
 		if err != nil {
-			panic(err)
+			return nil, path, false
 		}
-		return f.existsI(needle, m, true)
+		return f.existsI(path, needle, v, true)
 	}
-	return false
 }
 
 // ------------------------------------------------------------
 // SIZEIS-FN FUNCTION
 
-// sizeis is a function to evaluate the size of a slice.
+// sizeis is a function to evaluate the size of a slice, or
+// of the slice at a path in each item.
 type sizeisFn struct {
-	Size int `json:"size,omitempty"`
+	Size int      `json:"size,omitempty"`
+	Path []string `json:"path,omitempty"`
 }
 
 func (f sizeisFn) Eval(resp []interface{}) error {
-	if len(resp) == f.Size {
+	if len(f.Path) < 1 {
+		if err := f.sizeError("", len(resp)); err != nil {
+			return err
+		}
+		return nil
+	}
+	s := newCmpState(cmpOpts{All: true})
+	for i, item := range resp {
+		path := joinIndex("", i)
+		for _, p := range f.Path {
+			path = joinKey(path, p)
+		}
+		m, err := normalize(item)
+		if err != nil {
+			return err
+		}
+		v, ok := lookupPath(m, f.Path)
+		if !ok {
+			err := newMismatchError(path, ReasonMissing, nil, nil)
+			err.s = fmt.Sprintf(sizeMissingFmt, f.Size)
+			s.fail(err)
+		} else if list, ok := v.([]interface{}); !ok {
+			err := newMismatchError(path, ReasonType, nil, v)
+			err.s = fmt.Sprintf(sizeTypeFmt, jsonTypeOf(v), f.Size)
+			s.fail(err)
+		} else if err := f.sizeError(path, len(list)); err != nil {
+			s.fail(err)
+		}
+	}
+	return s.err()
+}
+
+// sizeError() answers an error if size is wrong.
+func (f sizeisFn) sizeError(path string, size int) *ComparisonError {
+	if size == f.Size {
 		return nil
 	}
-	return newComparisonError(fmt.Sprintf("Size mismatch, have %v want %v", len(resp), f.Size))
+	return &ComparisonError{
+		s:      fmt.Sprintf(sizeMismatchFmt, size, f.Size),
+		path:   path,
+		reason: ReasonLength,
+		want:   f.Size,
+		have:   size,
+	}
 }
 
 func (f sizeisFn) FactoryKey() string {
 	return sizeisFactoryKey
 }
 
+// ------------------------------------------------------------
+// EACH-FN FUNCTION
+
+// eachFn requires every item to pass a comparison.
+type eachFn struct {
+	Cmp CmperFactory `json:"cmp,omitempty"`
+}
+
+func (f eachFn) Eval(resp []interface{}) error {
+	_, failed, err := evalItems(f.Cmp, resp)
+	if err != nil || len(failed) < 1 {
+		return err
+	}
+	var errs []*ComparisonError
+	for i := range resp {
+		if ce, ok := failed[i]; ok {
+			errs = append(errs, ce.Mismatches()...)
+		}
+	}
+	return newMultiComparisonError(errs)
+}
+
+func (f eachFn) FactoryKey() string {
+	return eachFactoryKey
+}
+
+// ------------------------------------------------------------
+// NONE-FN FUNCTION
+
+// noneFn requires every item to fail a comparison.
+type noneFn struct {
+	Cmp CmperFactory `json:"cmp,omitempty"`
+}
+
+func (f noneFn) Eval(resp []interface{}) error {
+	matched, _, err := evalItems(f.Cmp, resp)
+	if err != nil || len(matched) < 1 {
+		return err
+	}
+	var errs []*ComparisonError
+	for _, i := range matched {
+		errs = append(errs, newMismatchError(joinIndex("", i), ReasonNot, nil, resp[i]))
+	}
+	return newMultiComparisonError(errs)
+}
+
+func (f noneFn) FactoryKey() string {
+	return noneFactoryKey
+}
+
+// ------------------------------------------------------------
+// COUNT-FN FUNCTION
+
+// countFn requires the number of items that pass a comparison
+// to be within a range. A negative Max has no upper bound.
+type countFn struct {
+	Min int          `json:"min,omitempty"`
+	Max int          `json:"max,omitempty"`
+	Cmp CmperFactory `json:"cmp,omitempty"`
+}
+
+func (f countFn) Eval(resp []interface{}) error {
+	matched, failed, err := evalItems(f.Cmp, resp)
+	if err != nil {
+		return err
+	}
+	// Report the items that pushed the count out of range.
+	var offending []int
+	detail := unmatchedDetail
+	if len(matched) < f.Min {
+		for i := range failed {
+			offending = append(offending, i)
+		}
+		sort.Ints(offending)
+	} else if f.Max >= 0 && len(matched) > f.Max {
+		offending = matched
+		detail = matchedDetail
+	} else {
+		return nil
+	}
+	paths := make([]string, 0, len(offending))
+	for _, i := range offending {
+		paths = append(paths, joinIndex("", i))
+	}
+	ce := newMismatchError("", ReasonCount, f.describe(), len(matched))
+	ce.detail = detail + " " + strings.Join(paths, ", ")
+	return ce
+}
+
+func (f countFn) FactoryKey() string {
+	return countFactoryKey
+}
+
+// describe() answers the allowed count, for example "at least 2".
+func (f countFn) describe() string {
+	switch {
+	case f.Min == f.Max:
+		return fmt.Sprintf("exactly %v", f.Min)
+	case f.Max < 0:
+		return fmt.Sprintf("at least %v", f.Min)
+	}
+	return fmt.Sprintf("at most %v", f.Max)
+}
+
+// evalItems() compares each item, answering the indexes of the
+// items that pass and the errors of those that fail, by index.
+// Any evaluation error ends the comparison.
+func evalItems(cmp CmperFactory, resp []interface{}) ([]int, map[int]*ComparisonError, error) {
+	var matched []int
+	failed := make(map[int]*ComparisonError)
+	for i, item := range resp {
+		err := prefixError(cmp.Cmp(item), joinIndex("", i))
+		if err == nil {
+			matched = append(matched, i)
+			continue
+		}
+		var ce *ComparisonError
+		if !errors.As(err, &ce) {
+			return nil, nil, err
+		}
+		failed[i] = ce
+	}
+	return matched, failed, nil
+}
+
 // ------------------------------------------------------------
 // FUNC-FACTORY
 
@@ -139,24 +322,26 @@ func (f FuncFactory) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON() overrides this struct's unmarshalling to remove the Fields layer.
 func (f *FuncFactory) UnmarshalJSON(data []byte) error {
 	glue := funcFactoryGlue{}
-	err := json.Unmarshal(data, &glue)
+	err := unmarshalJson(data, &glue)
 	if err != nil {
 		return err
 	}
-	switch glue.Key {
-	case keyFactoryKey:
-		fn := &keyFn{}
-		err = toFromJson(glue.Fn, fn)
-		f.Fn = fn
-	case notExistsFactoryKey:
-		fn := &notExistsFn{}
-		err = toFromJson(glue.Fn, fn)
-		f.Fn = fn
-	case sizeisFactoryKey:
-		fn := &sizeisFn{}
+	f.Fn = nil
+	if glue.Key == "" {
+		return nil
+	}
+	v, err := newRegistered(glue.Key)
+	if err != nil {
+		return err
+	}
+	fn, ok := v.(CmpsFunc)
+	if !ok {
+		return fmt.Errorf("jacl: %v is not a CmpsFunc", glue.Key)
+	}
+	if glue.Fn != nil {
 		err = toFromJson(glue.Fn, fn)
-		f.Fn = fn
 	}
+	f.Fn = fn
 	return err
 }
 
@@ -172,4 +357,13 @@ const (
 	keyFactoryKey       = "jacl-key"
 	notExistsFactoryKey = "jacl-notexists"
 	sizeisFactoryKey    = "jacl-sizeis"
+	eachFactoryKey      = "jacl-each"
+	noneFactoryKey      = "jacl-none"
+	countFactoryKey     = "jacl-count"
+
+	sizeMismatchFmt = "Size mismatch, have %v want %v"
+	sizeMissingFmt  = "missing, want size %v"
+	sizeTypeFmt     = "have %v want size %v"
+	matchedDetail   = "matched"
+	unmatchedDetail = "unmatched"
 )
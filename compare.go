@@ -1,83 +1,534 @@
 package jacl
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
 )
 
-// compare() compares two interface values.
+// compare() compares two interface values, answering nil or a
+// ComparisonError that locates the first mismatch.
 // All element of a must be in b, but not vice versa. It does not
 // handle custom types, but assumes the values have been reduced
-// to primitives.
-func compare(a, b interface{}) bool {
+// to primitives. The path is the location of a and b in the
+// larger document, and is used for error reporting.
+func compare(path string, a, b interface{}) error {
+	s := newCmpState(cmpOpts{})
+	s.compare(path, a, b)
+	return s.err()
+}
+
+// equalValues() answers true if a and b are the same value, where
+// compare() only requires b to contain a.
+func equalValues(a, b interface{}) bool {
+	return compare("", a, b) == nil && compare("", b, a) == nil
+}
+
+// compareBasicTypes() compares basic types.
+func compareBasicTypes(a, b interface{}) (bool, error) {
+	if a == nil && b == nil {
+		return true, nil
+	}
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return av == bv, nil
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return av == bv, nil
+		}
+	}
+	return false, fmt.Errorf("can't compare %T with %T", a, b)
+}
+
+// compareNumbers() compares two JSON numbers. Integers are compared
+// exactly, regardless of size. Anything else is compared as float64,
+// and is equal if the difference is within either the absolute or
+// relative tolerance.
+func compareNumbers(a, b json.Number, abs, rel float64) bool {
+	if a == b {
+		return true
+	}
+	if abs == 0 && rel == 0 {
+		ai, aok := new(big.Int).SetString(string(a), 10)
+		bi, bok := new(big.Int).SetString(string(b), 10)
+		if aok && bok {
+			return ai.Cmp(bi) == 0
+		}
+	}
+	af, aerr := a.Float64()
+	bf, berr := b.Float64()
+	if aerr != nil || berr != nil {
+		return false
+	}
+	return withinTolerance(af, bf, abs, rel)
+}
+
+// orderNumbers() answers -1, 0 or 1 as a is less than, equal to or
+// greater than b. As with compareNumbers(), integers are compared
+// exactly, regardless of size. Anything else is compared as a
+// big.Float. It answers false if either is not a number.
+func orderNumbers(a, b json.Number) (int, bool) {
+	ai, aok := new(big.Int).SetString(string(a), 10)
+	bi, bok := new(big.Int).SetString(string(b), 10)
+	if aok && bok {
+		return ai.Cmp(bi), true
+	}
+	af, _, aerr := big.ParseFloat(string(a), 10, numberPrec, big.ToNearestEven)
+	bf, _, berr := big.ParseFloat(string(b), 10, numberPrec, big.ToNearestEven)
+	if aerr != nil || berr != nil {
+		return 0, false
+	}
+	return af.Cmp(bf), true
+}
+
+// withinTolerance() answers true if a and b are equal within
+// either the absolute or relative tolerance.
+func withinTolerance(a, b, abs, rel float64) bool {
+	if a == b {
+		return true
+	}
+	diff := math.Abs(a - b)
+	if diff <= abs {
+		return true
+	}
+	return diff <= rel*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// ------------------------------------------------------------
+// CMP-STATE
+
+// cmpState carries the options and the accumulated mismatches
+// of a single comparison.
+type cmpState struct {
+	opts  cmpOpts
+	errs  []*ComparisonError
+	rootA interface{}
+	rootB interface{}
+	// The options the roots were compared with.
+	rootOpts cmpOpts
+	// For each slice in b that isn't matched by index, the index
+	// of the element of b matched to each element of a, or -1.
+	// Keyed by the path of the slice.
+	pairs map[string][]int
+	// The compiled cmpOpts.Open patterns, shared with forks.
+	open []*regexp.Regexp
+	// The Vars, and any values captured from b.
+	scope *varScope
+	// The first matcher in a that couldn't be reinstantiated.
+	evalErr error
+}
+
+func newCmpState(opts cmpOpts) *cmpState {
+	s := &cmpState{opts: opts, scope: newVarScope(opts.vars)}
+	if opts.Strict {
+		s.open = compileOpenPaths(opts.Open)
+	}
+	return s
+}
+
+// fork() answers a state with opts that sees the values captured
+// so far, but whose own captures are discarded.
+func (s *cmpState) fork(opts cmpOpts) *cmpState {
+	return &cmpState{opts: opts, open: s.open, scope: s.scope.fork()}
+}
+
+// fail() records a mismatch, answering true if the
+// comparison should continue.
+func (s *cmpState) fail(err *ComparisonError) bool {
+	s.errs = append(s.errs, err)
+	return s.opts.All
+}
+
+// failErr() records an error answered by a CmpsFunc. Comparison
+// errors are recorded as mismatches, anything else is an
+// evaluation error that ends the comparison.
+func (s *cmpState) failErr(err error) (bool, error) {
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		for _, e := range ce.Mismatches() {
+			s.fail(e)
+		}
+		return s.opts.All, nil
+	}
+	return false, newEvaluationError(err)
+}
+
+// failEval() records an error that prevented a comparison, which
+// ends it with an evaluation error.
+func (s *cmpState) failEval(err error) bool {
+	if s.evalErr == nil {
+		s.evalErr = err
+	}
+	return false
+}
+
+// setPairs() records the elements of the slice at path matched
+// to each element of a, so errors can render a diff.
+func (s *cmpState) setPairs(path string, pairs []int) {
+	if s.pairs == nil {
+		s.pairs = make(map[string][]int)
+	}
+	s.pairs[path] = pairs
+}
+
+// setRoot() sets the complete values being compared, so errors
+// can render a diff.
+func (s *cmpState) setRoot(a, b interface{}) {
+	s.rootA = a
+	s.rootB = b
+	s.rootOpts = s.opts
+}
+
+// err() answers nil if no mismatches were recorded, otherwise a
+// ComparisonError describing them.
+func (s *cmpState) err() error {
+	if s.evalErr != nil {
+		return newEvaluationError(s.evalErr)
+	}
+	var err *ComparisonError
+	switch len(s.errs) {
+	case 0:
+		return nil
+	case 1:
+		err = s.errs[0]
+	default:
+		err = newMultiComparisonError(s.errs)
+	}
+	err.rootA, err.rootB, err.rootPairs = s.rootA, s.rootB, s.pairs
+	err.rootOpts = s.rootOpts
+	return err
+}
+
+// compare() answers true if all the values of a are in b,
+// recording any mismatches.
+func (s *cmpState) compare(path string, a, b interface{}) bool {
+	if m, ok, err := asMatcher(a); ok {
+		if err != nil {
+			return s.failEval(err)
+		}
+		if pm, ok := m.(missingMatcher); ok {
+			return s.comparePresence(path, pm, a, b, true)
+		}
+		if vm, ok := m.(varsMatcher); ok {
+			err = vm.matchVars(b, s.scope)
+		} else {
+			err = m.Match(b)
+		}
+		if err == nil {
+			return true
+		}
+		e := newMismatchError(path, ReasonMatch, a, b)
+		e.detail = err.Error()
+		s.fail(e)
+		return false
+	}
 	ans, err := compareBasicTypes(a, b)
 	if err == nil {
-		return ans
+		if ans {
+			return true
+		}
+		s.fail(newMismatchError(path, ReasonValue, a, b))
+		return false
 	}
 	switch av := a.(type) {
+	case json.Number:
+		if bv, ok := b.(json.Number); ok {
+			if compareNumbers(av, bv, s.opts.Abs, s.opts.Rel) {
+				return true
+			}
+			s.fail(newMismatchError(path, ReasonValue, a, b))
+			return false
+		}
+		s.fail(newMismatchError(path, ReasonType, a, b))
+		return false
 	case map[string]interface{}:
 		if bv, ok := b.(map[string]interface{}); ok {
-			return compareStringInterfaceMap(av, bv)
+			return s.compareStringInterfaceMap(path, av, bv)
 		}
+		s.fail(newMismatchError(path, ReasonType, a, b))
 		return false
 	case []interface{}:
 		if bv, ok := b.([]interface{}); ok {
-			return compareInterfaceSlice(av, bv)
+			return s.compareInterfaceSlice(path, av, bv)
 		}
+		s.fail(newMismatchError(path, ReasonType, a, b))
 		return false
 	}
-	return a == b
+	if a == b {
+		return true
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		s.fail(newMismatchError(path, ReasonType, a, b))
+	} else {
+		s.fail(newMismatchError(path, ReasonValue, a, b))
+	}
+	return false
 }
 
-// compareBasicTypes() compares basic types.
-func compareBasicTypes(a, b interface{}) (bool, error) {
-	if a == nil && b == nil {
-		return true, nil
+// compareMember() compares the value of a key in a, which is
+// missing from b unless exists is true. Only a missing matcher
+// can match a missing value.
+func (s *cmpState) compareMember(path string, a, b interface{}, exists bool) bool {
+	if exists {
+		return s.compare(path, a, b)
 	}
-	switch av := a.(type) {
-	case string:
-		if bv, ok := b.(string); ok {
-			return av == bv, nil
+	if m, ok, err := asMatcher(a); ok {
+		if err != nil {
+			return s.failEval(err)
 		}
-	case bool:
-		if bv, ok := b.(bool); ok {
-			return av == bv, nil
+		if pm, ok := m.(missingMatcher); ok {
+			return s.comparePresence(path, pm, a, nil, false)
 		}
 	}
-	return false, fmt.Errorf("can't compare %T with %T", a, b)
+	s.fail(newMismatchError(path, ReasonMissing, a, nil))
+	return false
+}
+
+// comparePresence() compares b with a missing matcher, recording
+// the reason it gives for a mismatch.
+func (s *cmpState) comparePresence(path string, m missingMatcher, a, b interface{}, exists bool) bool {
+	reason, err := m.matchPresence(b, exists)
+	if err == nil {
+		return true
+	}
+	e := newMismatchError(path, reason, a, b)
+	e.s = err.Error()
+	s.fail(e)
+	return false
 }
 
 // compareStringInterfaceMap() compares two maps of string to interface.
-func compareStringInterfaceMap(a, b map[string]interface{}) bool {
+func (s *cmpState) compareStringInterfaceMap(path string, a, b map[string]interface{}) bool {
 	if a == nil && b == nil {
 		return true
 	} else if a != nil && b == nil {
+		s.fail(newMismatchError(path, ReasonValue, a, nil))
 		return false
 	} else if a == nil && b != nil {
+		s.fail(newMismatchError(path, ReasonValue, nil, b))
 		return false
 	}
-	for ak, av := range a {
+	ans := true
+	for _, ak := range sortedKeys(a) {
 		bv, ok := b[ak]
-		if !ok {
-			return false
+		if !s.compareMember(joinKey(path, ak), a[ak], bv, ok) {
+			ans = false
+			if !s.opts.All {
+				return false
+			}
+		}
+	}
+	return s.compareExtraKeys(path, a, b) && ans
+}
+
+// compareExtraKeys() answers false if this is a strict comparison
+// and b has keys that are not in a.
+func (s *cmpState) compareExtraKeys(path string, a, b map[string]interface{}) bool {
+	if !s.isStrict(path) {
+		return true
+	}
+	ans := true
+	for _, bk := range sortedKeys(b) {
+		if _, ok := a[bk]; !ok && s.isStrict(joinKey(path, bk)) {
+			ans = false
+			if !s.fail(newMismatchError(joinKey(path, bk), ReasonUnexpected, nil, b[bk])) {
+				return false
+			}
 		}
-		if !compare(av, bv) {
+	}
+	return ans
+}
+
+// compareExtraItems() answers false if this is a strict comparison
+// and b has items that are not in used.
+func (s *cmpState) compareExtraItems(path string, b []interface{}, used []bool) bool {
+	if !s.isStrict(path) {
+		return true
+	}
+	ans := true
+	for bi, bv := range b {
+		if (bi >= len(used) || !used[bi]) && s.isStrict(joinIndex(path, bi)) {
+			ans = false
+			if !s.fail(newMismatchError(joinIndex(path, bi), ReasonUnexpected, nil, bv)) {
+				return false
+			}
+		}
+	}
+	return ans
+}
+
+// isStrict() answers true if extra values at or below path are
+// mismatches.
+func (s *cmpState) isStrict(path string) bool {
+	if !s.opts.Strict {
+		return false
+	}
+	for _, re := range s.open {
+		if re.MatchString(path) {
 			return false
 		}
 	}
 	return true
 }
 
-// compareInterfaceSlice() compares two maps of string to interface.
-func compareInterfaceSlice(a, b []interface{}) bool {
+// compareInterfaceSlice() compares two slices of interface.
+func (s *cmpState) compareInterfaceSlice(path string, a, b []interface{}) bool {
+	if s.opts.Unordered {
+		return s.compareUnordered(path, a, b, false)
+	}
 	if len(a) != len(b) {
+		s.fail(newMismatchError(path, ReasonLength, a, b))
 		return false
 	} else if a == nil {
 		return true
 	}
+	ans := true
 	for i, ae := range a {
-		if !compare(ae, b[i]) {
-			return false
+		if !s.compare(joinIndex(path, i), ae, b[i]) {
+			ans = false
+			if !s.opts.All {
+				return false
+			}
 		}
 	}
-	return true
+	return ans
 }
+
+// compareUnordered() compares two slices of interface regardless of
+// order. Each element of a must match a distinct element of b. If
+// extra is true b can contain more elements than a, as the list
+// compared by Cmps() can, otherwise the lengths must match. An
+// element of a without a partner is reported at its index in a.
+func (s *cmpState) compareUnordered(path string, a, b []interface{}, extra bool) bool {
+	if !extra && len(a) != len(b) {
+		s.fail(newMismatchError(path, ReasonLength, a, b))
+		return false
+	}
+	ans := true
+	used := make([]bool, len(b))
+	pairs, scopes := s.matchUnordered(a, b)
+	s.setPairs(path, pairs)
+	for ai, bi := range pairs {
+		if bi >= 0 {
+			used[bi] = true
+			if sc, ok := scopes[[2]int{ai, bi}]; ok {
+				s.scope.merge(sc)
+			}
+		} else {
+			ans = false
+			if !s.fail(newMismatchError(joinIndex(path, ai), ReasonUnmatched, a[ai], nil)) {
+				return false
+			}
+		}
+	}
+	return s.compareExtraItems(path, b, used) && ans
+}
+
+// matchUnordered() answers, for each element of a, the index of
+// the element of b it is paired with, or -1. This is a maximum
+// bipartite matching, so a single element of b can't satisfy
+// more than one element of a. It also answers the scope of each
+// matching pair, a and b index, that captured values.
+func (s *cmpState) matchUnordered(a, b []interface{}) ([]int, map[[2]int]*varScope) {
+	edges := make([][]int, len(a))
+	var scopes map[[2]int]*varScope
+	for ai := range a {
+		for bi := range b {
+			ok, sc := s.probe(a[ai], b[bi])
+			if !ok {
+				continue
+			}
+			edges[ai] = append(edges[ai], bi)
+			if sc.captured() {
+				if scopes == nil {
+					scopes = make(map[[2]int]*varScope)
+				}
+				scopes[[2]int{ai, bi}] = sc
+			}
+		}
+	}
+	owners := make([]int, len(b))
+	for i := range owners {
+		owners[i] = -1
+	}
+	var assign func(ai int, seen []bool) bool
+	assign = func(ai int, seen []bool) bool {
+		for _, bi := range edges[ai] {
+			if seen[bi] {
+				continue
+			}
+			seen[bi] = true
+			if owners[bi] < 0 || assign(owners[bi], seen) {
+				owners[bi] = ai
+				return true
+			}
+		}
+		return false
+	}
+	for ai := range a {
+		assign(ai, make([]bool, len(b)))
+	}
+	pairs := make([]int, len(a))
+	for i := range pairs {
+		pairs[i] = -1
+	}
+	for bi, ai := range owners {
+		if ai >= 0 {
+			pairs[ai] = bi
+		}
+	}
+	return pairs, scopes
+}
+
+// probe() answers true if all the values of a are in b,
+// without recording any mismatches. It also answers the
+// scope of the probe, which can be merged to keep its
+// captures.
+func (s *cmpState) probe(a, b interface{}) (bool, *varScope) {
+	p := s.fork(s.opts)
+	p.opts.All = false
+	ok := p.compare("", a, b)
+	if p.evalErr != nil {
+		s.failEval(p.evalErr)
+	}
+	return ok, p.scope
+}
+
+// probeKey() answers true if the key value a compares equal to b.
+// Only the tolerance and Vars apply, the other options don't
+// affect keys.
+func (s *cmpState) probeKey(a, b interface{}) bool {
+	opts := cmpOpts{Abs: s.opts.Abs, Rel: s.opts.Rel, vars: s.opts.vars}
+	p := s.fork(opts)
+	ok := p.compare("", a, b)
+	if p.evalErr != nil {
+		s.failEval(p.evalErr)
+	}
+	return ok
+}
+
+// sortedKeys() answers the keys of m in sorted order, so
+// mismatches are reported consistently.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// The precision, in bits, of numbers compared as big.Float.
+	numberPrec = 256
+)
@@ -0,0 +1,203 @@
+package jacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// DIFF
+
+// renderDiff() answers a unified diff of b against a. Only the
+// parts of b touched by a are shown; everything else is elided.
+// Lines starting with - are the expected values from a, lines
+// starting with + are the actual values from b. pairs holds the
+// elements of b matched to each element of a, see cmpState.pairs,
+// and opts are the options a and b were compared with.
+func renderDiff(a, b interface{}, pairs map[string][]int, opts cmpOpts, color bool) string {
+	var sb strings.Builder
+	d := differ{pairs: pairs, opts: opts}
+	for _, l := range d.value("", "", a, b, 0) {
+		l.writeTo(&sb, color)
+	}
+	return sb.String()
+}
+
+// differ renders the lines of a diff.
+type differ struct {
+	// For each slice path in b, the index of the element of b
+	// matched to each element of a, or -1. Slices without an
+	// entry are matched by index.
+	pairs map[string][]int
+	// The options of the comparison, so values it accepted
+	// are shown unchanged.
+	opts cmpOpts
+}
+
+// value() answers the lines that describe b, found at path,
+// against a. The prefix is written before the first line, and
+// is used for keys.
+func (d differ) value(path, prefix string, a, b interface{}, indent int) []diffLine {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var entries [][]diffLine
+		found := 0
+		for _, k := range sortedKeys(av) {
+			kp := strconv.Quote(k) + ": "
+			if bvv, ok := bv[k]; ok {
+				found++
+				entries = append(entries, d.value(joinKey(path, k), kp, av[k], bvv, indent+1))
+			} else {
+				entries = append(entries, valueLines('-', kp, av[k], indent+1))
+			}
+		}
+		return diffContainer(prefix+"{", "}", entries, len(bv)-found, moreFieldsFmt, indent)
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		var entries [][]diffLine
+		pairs, paired := d.pairs[path]
+		found := 0
+		for i, avv := range av {
+			bi := i
+			if paired {
+				bi = -1
+				if i < len(pairs) {
+					bi = pairs[i]
+				}
+			}
+			if bi >= 0 && bi < len(bv) {
+				found++
+				entries = append(entries, d.value(joinIndex(path, bi), "", avv, bv[bi], indent+1))
+			} else {
+				entries = append(entries, valueLines('-', "", avv, indent+1))
+			}
+		}
+		return diffContainer(prefix+"[", "]", entries, len(bv)-found, moreItemsFmt, indent)
+	}
+	if d.equal(a, b) {
+		return valueLines(' ', prefix, a, indent)
+	}
+	return append(valueLines('-', prefix, a, indent), valueLines('+', prefix, b, indent)...)
+}
+
+// equal() answers true if the comparison accepted b for a.
+// Only the tolerance and Vars apply to the values that reach
+// here, the other options affect containers.
+func (d differ) equal(a, b interface{}) bool {
+	opts := cmpOpts{Abs: d.opts.Abs, Rel: d.opts.Rel, vars: d.opts.vars}
+	return newCmpState(opts).compare("", a, b)
+}
+
+// diffContainer() answers the lines for an object or array
+// made of entries, noting any elided items in b.
+func diffContainer(open, close string, entries [][]diffLine, elided int, elidedFmt string, indent int) []diffLine {
+	lines := []diffLine{{' ', indent, open}}
+	for i, e := range entries {
+		if i+1 < len(entries) || elided > 0 {
+			addComma(e)
+		}
+		lines = append(lines, e...)
+	}
+	if elided > 0 {
+		lines = append(lines, diffLine{' ', indent + 1, fmt.Sprintf(elidedFmt, elided)})
+	}
+	return append(lines, diffLine{' ', indent, close})
+}
+
+// valueLines() answers the pretty-printed lines of v.
+func valueLines(mark byte, prefix string, v interface{}, indent int) []diffLine {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b = []byte(fmt.Sprintf("%v", v))
+	}
+	var lines []diffLine
+	for i, s := range strings.Split(string(b), "\n") {
+		if i == 0 {
+			s = prefix + s
+		}
+		lines = append(lines, diffLine{mark, indent, s})
+	}
+	return lines
+}
+
+// addComma() terminates an entry with a comma. A changed value
+// is made of a removed and an added value, and both need one.
+func addComma(lines []diffLine) {
+	last := len(lines) - 1
+	if last < 0 {
+		return
+	}
+	lines[last].text += ","
+	if lines[0].mark != '-' || lines[last].mark != '+' {
+		return
+	}
+	for i := last; i >= 0; i-- {
+		if lines[i].mark == '-' {
+			lines[i].text += ","
+			return
+		}
+	}
+}
+
+// useColor() answers true if diffs should include ANSI colors.
+func useColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ------------------------------------------------------------
+// DIFF-LINE
+
+// diffLine is a single line in a rendered diff.
+type diffLine struct {
+	mark   byte // ' ', '-' or '+'
+	indent int
+	text   string
+}
+
+func (l diffLine) writeTo(sb *strings.Builder, color bool) {
+	if color {
+		switch l.mark {
+		case '-':
+			sb.WriteString(ansiRed)
+		case '+':
+			sb.WriteString(ansiGreen)
+		}
+	}
+	sb.WriteByte(l.mark)
+	sb.WriteByte(' ')
+	sb.WriteString(strings.Repeat("  ", l.indent))
+	sb.WriteString(l.text)
+	if color && l.mark != ' ' {
+		sb.WriteString(ansiReset)
+	}
+	sb.WriteByte('\n')
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	moreFieldsFmt = "… %v more fields"
+	moreItemsFmt  = "… %v more items"
+
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
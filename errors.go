@@ -2,22 +2,315 @@ package jacl
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 // ------------------------------------------------------------
 // COMPARISON-ERROR
 
-// ComparisonError indicates that a comparison failed.
+// ComparisonError indicates that a comparison failed. When the
+// failure can be located in B, the error carries the path to the
+// first mismatching field along with the expected and actual values.
+// When the comparison was run with AllErrors() it can also hold
+// every mismatch that was found, see Mismatches().
 type ComparisonError struct {
-	s string
+	s      string
+	path   string
+	reason Reason
+	want   interface{}
+	have   interface{}
+	detail string
+	errs   []*ComparisonError
+	// The result of each branch of All() or AnyOf().
+	branches []*ComparisonError
+	// The complete values being compared, used to render a diff.
+	rootA interface{}
+	rootB interface{}
+	// The elements of B matched to A, used to render a diff.
+	rootPairs map[string][]int
+	// The options A and B were compared with, used to render a diff.
+	rootOpts cmpOpts
+	// Set by Eventually() and Consistently().
+	attempts int
+	elapsed  time.Duration
 }
 
 func newComparisonError(s string) error {
 	return &ComparisonError{s: s}
 }
 
+// newMismatchError() answers a new comparison error for a
+// mismatch at the supplied path.
+func newMismatchError(path string, reason Reason, want, have interface{}) *ComparisonError {
+	return &ComparisonError{path: path, reason: reason, want: want, have: have}
+}
+
+// newMultiComparisonError() answers a new comparison error that
+// holds a list of mismatches. The accessors describe the first.
+func newMultiComparisonError(errs []*ComparisonError) *ComparisonError {
+	e := *errs[0]
+	e.errs = errs
+	return &e
+}
+
+// newBranchError() answers a new comparison error for a
+// combinator, with an entry in branches for each child. Children
+// that passed are nil.
+func newBranchError(reason Reason, branches []*ComparisonError) *ComparisonError {
+	return &ComparisonError{reason: reason, branches: branches}
+}
+
+// withPrefix() answers a copy of the error with prefix
+// added to the path of each mismatch.
+func (e *ComparisonError) withPrefix(prefix string) *ComparisonError {
+	return e.withPathFunc(func(path string) string {
+		return joinPath(prefix, path)
+	})
+}
+
+// withPathFunc() answers a copy of the error with the path
+// of each mismatch replaced by fn.
+func (e *ComparisonError) withPathFunc(fn func(string) string) *ComparisonError {
+	c := *e
+	c.path = fn(e.path)
+	if len(e.errs) > 0 {
+		c.errs = make([]*ComparisonError, 0, len(e.errs))
+		for _, err := range e.errs {
+			c.errs = append(c.errs, err.withPathFunc(fn))
+		}
+	}
+	if len(e.branches) > 0 {
+		c.branches = make([]*ComparisonError, len(e.branches))
+		for i, err := range e.branches {
+			if err != nil {
+				c.branches[i] = err.withPathFunc(fn)
+			}
+		}
+	}
+	return &c
+}
+
+// prefixError() answers err with prefix added to the path
+// of a comparison error, or to the message of anything else.
+func prefixError(err error, prefix string) error {
+	if err == nil || prefix == "" {
+		return err
+	}
+	var ee *EvaluationError
+	if errors.As(err, &ee) {
+		return newEvaluationError(fmt.Errorf("%v: %w", prefix, ee.err))
+	}
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		return ce.withPrefix(prefix)
+	}
+	return newEvaluationError(fmt.Errorf("%v: %w", prefix, err))
+}
+
 func (e *ComparisonError) Error() string {
-	return e.s
+	if e.attempts > 0 {
+		return fmt.Sprintf(attemptsFmt+": %v", e.attempts, e.elapsed.Round(time.Millisecond), e.message())
+	}
+	return e.message()
+}
+
+// message() answers the error without the attempts.
+func (e *ComparisonError) message() string {
+	if len(e.errs) > 1 {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, mismatchesFmt, len(e.errs))
+		for _, err := range e.errs {
+			sb.WriteString("\n\t")
+			sb.WriteString(err.Error())
+		}
+		return sb.String()
+	}
+	var msg string
+	switch e.reason {
+	case ReasonMissing:
+		msg = fmt.Sprintf(missingWantFmt, toJson(e.want))
+	case ReasonExists:
+		msg = fmt.Sprintf(haveWantNoneFmt, toJson(e.have))
+	case ReasonMatch:
+		msg = fmt.Sprintf(haveDetailFmt, toJson(e.have), e.detail)
+	case ReasonUnmatched:
+		msg = fmt.Sprintf(unmatchedWantFmt, toJson(e.want))
+	case ReasonUnexpected:
+		msg = fmt.Sprintf(unexpectedFmt, toJson(e.have))
+	case ReasonAmbiguous:
+		msg = fmt.Sprintf(ambiguousKeyFmt, toJson(e.want), e.detail)
+	case ReasonAll, ReasonAnyOf:
+		msg = e.branchesMsg()
+	case ReasonNot:
+		msg = notMatchedMsg
+	case ReasonCount:
+		msg = fmt.Sprintf(countFmt, e.have, e.want, e.detail)
+	case ReasonSchema:
+		msg = fmt.Sprintf(haveDetailFmt, toJson(e.have), e.detail)
+	case ReasonLength:
+		msg = fmt.Sprintf(haveWantLengthFmt, lengthOf(e.have), lengthOf(e.want))
+	default:
+		msg = fmt.Sprintf(haveWantFmt, toJson(e.have), toJson(e.want))
+	}
+	if e.s != "" {
+		msg = e.s
+	}
+	if e.path == "" {
+		return msg
+	}
+	return e.path + ": " + msg
+}
+
+// branchesMsg() answers the message for a combinator: a line
+// for each failed branch, indented beneath a summary.
+func (e *ComparisonError) branchesMsg() string {
+	failed := 0
+	for _, b := range e.branches {
+		if b != nil {
+			failed++
+		}
+	}
+	var sb strings.Builder
+	if e.reason == ReasonAnyOf {
+		fmt.Fprintf(&sb, anyOfFailedFmt, len(e.branches))
+	} else {
+		fmt.Fprintf(&sb, allFailedFmt, failed, len(e.branches))
+	}
+	for i, b := range e.branches {
+		if b != nil {
+			fmt.Fprintf(&sb, branchFmt, i, strings.ReplaceAll(b.Error(), "\n", "\n\t"))
+		}
+	}
+	return sb.String()
+}
+
+// Path answers the location of the mismatch in B, for example
+// items[3].owner.email. The root of B is an empty string. An
+// element of A with no partner in B, ReasonUnmatched, has no
+// location in B, so its path ends with its index in A.
+func (e *ComparisonError) Path() string {
+	return e.path
+}
+
+// Want answers the expected value at Path().
+func (e *ComparisonError) Want() interface{} {
+	return e.want
+}
+
+// Have answers the actual value at Path().
+func (e *ComparisonError) Have() interface{} {
+	return e.have
+}
+
+// Reason answers why the comparison failed.
+func (e *ComparisonError) Reason() Reason {
+	return e.reason
+}
+
+// Diff answers a unified diff of the compared values, showing only
+// the parts of B touched by A. Lines starting with - are expected,
+// lines starting with + are actual. The diff is colored when stdout
+// is a terminal. Answers an empty string if the values are unknown.
+func (e *ComparisonError) Diff() string {
+	if e.rootA == nil && e.rootB == nil {
+		return ""
+	}
+	return renderDiff(e.rootA, e.rootB, e.rootPairs, e.rootOpts, useColor())
+}
+
+// Detail answers additional information about the mismatch,
+// such as the reason a Matcher failed.
+func (e *ComparisonError) Detail() string {
+	return e.detail
+}
+
+// Branches answers the result of each branch of All() or AnyOf(),
+// in order. A branch that passed is nil. Anything else answers nil.
+func (e *ComparisonError) Branches() []*ComparisonError {
+	return e.branches
+}
+
+// Attempts answers the number of comparisons made by Eventually()
+// or Consistently() before answering this error. Anything else
+// answers 0.
+func (e *ComparisonError) Attempts() int {
+	return e.attempts
+}
+
+// Elapsed answers the time Eventually() or Consistently() spent
+// before answering this error. Anything else answers 0.
+func (e *ComparisonError) Elapsed() time.Duration {
+	return e.elapsed
+}
+
+// Mismatches answers each individual mismatch, with its own
+// path. Unless the comparison was run with AllErrors() this is
+// just the receiver.
+func (e *ComparisonError) Mismatches() []*ComparisonError {
+	if len(e.errs) > 0 {
+		return e.errs
+	}
+	return []*ComparisonError{e}
+}
+
+// ------------------------------------------------------------
+// REASON
+
+// Reason describes why a comparison failed.
+type Reason int
+
+const (
+	ReasonUnknown    Reason = iota // No specific reason is available
+	ReasonValue                    // The values are different
+	ReasonType                     // The values are different types
+	ReasonMissing                  // The value is missing from B
+	ReasonLength                   // The slices are different lengths
+	ReasonExists                   // The value is in B but should not be
+	ReasonMatch                    // The value failed a Matcher
+	ReasonUnmatched                // No element in B matches this element of A
+	ReasonUnexpected               // The value is in B but not A, in a strict comparison
+	ReasonAmbiguous                // More than one element in B has this element's keys
+	ReasonAll                      // One or more branches of All() failed, see Branches()
+	ReasonAnyOf                    // Every branch of AnyOf() failed, see Branches()
+	ReasonNot                      // B matched the expectation passed to Not()
+	ReasonCount                    // The number of matching elements is out of range
+	ReasonSchema                   // The value violates a JSON Schema, the path is a JSON Pointer
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonValue:
+		return "value"
+	case ReasonType:
+		return "type"
+	case ReasonMissing:
+		return "missing"
+	case ReasonLength:
+		return "length"
+	case ReasonExists:
+		return "exists"
+	case ReasonMatch:
+		return "match"
+	case ReasonUnmatched:
+		return "unmatched"
+	case ReasonUnexpected:
+		return "unexpected"
+	case ReasonAmbiguous:
+		return "ambiguous"
+	case ReasonAll:
+		return "all"
+	case ReasonAnyOf:
+		return "any of"
+	case ReasonNot:
+		return "not"
+	case ReasonCount:
+		return "count"
+	case ReasonSchema:
+		return "schema"
+	}
+	return "unknown"
 }
 
 // ------------------------------------------------------------
@@ -62,10 +355,33 @@ func equalErr(a, b error) bool {
 	}
 }
 
+// ------------------------------------------------------------
+// MISC
+
+// lengthOf() answers the length of a slice, or 0.
+func lengthOf(v interface{}) int {
+	if s, ok := v.([]interface{}); ok {
+		return len(s)
+	}
+	return 0
+}
+
 // ------------------------------------------------------------
 // CONST and VAR
 
 const (
 	haveWantFmt       = "have %v want %v"
 	haveWantLengthFmt = "have length %v want length %v"
+	missingWantFmt    = "missing, want %v"
+	haveWantNoneFmt   = "have %v want none"
+	mismatchesFmt     = "%v mismatches:"
+	haveDetailFmt     = "have %v, %v"
+	unmatchedWantFmt  = "no match, want %v"
+	unexpectedFmt     = "unexpected %v"
+	ambiguousKeyFmt   = "ambiguous key %v, matches %v"
+	allFailedFmt      = "%v of %v branches failed:"
+	anyOfFailedFmt    = "none of %v branches matched:"
+	branchFmt         = "\n\t[%v] %v"
+	notMatchedMsg     = "matched, want no match"
+	countFmt          = "have %v matching want %v, %v"
 )
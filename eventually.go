@@ -0,0 +1,198 @@
+package jacl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ------------------------------------------------------------
+// EVENTUALLY
+
+// Eventually calls fetch and compares the result with cmp until the
+// comparison passes or timeout elapses, waiting interval between
+// attempts. An interval of 0 or less uses a default of 100ms.
+//
+// On timeout it answers the last ComparisonError, with Attempts()
+// and Elapsed() set, even if later attempts could not fetch a value.
+// If no comparison was made, it answers an EvaluationError that
+// wraps the last error from fetch.
+func Eventually(fetch func() (interface{}, error), cmp Cmper, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return EventuallyContext(ctx, ignoreContext(fetch), cmp, interval)
+}
+
+// EventuallyContext is Eventually, but polls until ctx is done, and
+// passes ctx to fetch. A fetch that is still running when ctx is done
+// is abandoned. At least one attempt is always started.
+func EventuallyContext(ctx context.Context, fetch func(context.Context) (interface{}, error), cmp Cmper, interval time.Duration) error {
+	p := newPoller(fetch, cmp, interval)
+	for {
+		done, err := p.attempt(ctx)
+		if err == nil {
+			return nil
+		}
+		if done || !p.wait(ctx) {
+			return p.finish(p.lastOr(err))
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// CONSISTENTLY
+
+// Consistently calls fetch and compares the result with cmp until
+// duration elapses, waiting interval between attempts. It fails on
+// the first attempt that does not pass. An interval of 0 or less
+// uses a default of 100ms.
+//
+// A failed comparison is a ComparisonError, with Attempts() and
+// Elapsed() set. An error from fetch is an EvaluationError that
+// wraps it.
+func Consistently(fetch func() (interface{}, error), cmp Cmper, duration, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	return ConsistentlyContext(ctx, ignoreContext(fetch), cmp, interval)
+}
+
+// ConsistentlyContext is Consistently, but polls until ctx is done,
+// and passes ctx to fetch. Reaching the deadline of ctx passes, even
+// during a fetch, which is abandoned. Cancelling ctx answers an
+// EvaluationError, since the comparison did not run for the full
+// duration. At least one attempt is always started.
+func ConsistentlyContext(ctx context.Context, fetch func(context.Context) (interface{}, error), cmp Cmper, interval time.Duration) error {
+	p := newPoller(fetch, cmp, interval)
+	for {
+		done, err := p.attempt(ctx)
+		if !done && err != nil {
+			return p.finish(err)
+		}
+		if done || !p.wait(ctx) {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil
+			}
+			return p.finish(newEvaluationError(ctx.Err()))
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// POLLER
+
+// poller runs the attempts for Eventually() and Consistently().
+type poller struct {
+	fetch    func(context.Context) (interface{}, error)
+	cmp      Cmper
+	interval time.Duration
+	start    time.Time
+	attempts int
+	// The most recent failed comparison, and the most recent
+	// error from an attempt that wasn't abandoned.
+	last    *ComparisonError
+	lastErr error
+}
+
+// fetchResult is the answer from a fetch.
+type fetchResult struct {
+	v   interface{}
+	err error
+}
+
+func newPoller(fetch func(context.Context) (interface{}, error), cmp Cmper, interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	return &poller{fetch: fetch, cmp: cmp, interval: interval, start: time.Now()}
+}
+
+// attempt() fetches a value and compares it. The fetch runs in its
+// own goroutine, so a fetch that ignores ctx can't block past it.
+// It answers true if ctx was done before the fetch answered.
+func (p *poller) attempt(ctx context.Context) (bool, error) {
+	p.attempts++
+	results := make(chan fetchResult, 1)
+	go func() {
+		v, err := p.fetch(ctx)
+		results <- fetchResult{v, err}
+	}()
+	var r fetchResult
+	select {
+	case r = <-results:
+	case <-ctx.Done():
+		return true, newEvaluationError(fmt.Errorf(fetchErrFmt, ctx.Err()))
+	}
+	var err error
+	if r.err != nil {
+		err = newEvaluationError(fmt.Errorf(fetchErrFmt, r.err))
+	} else {
+		err = p.cmp.Cmp(r.v)
+	}
+	p.lastErr = err
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		p.last = ce
+	}
+	return false, err
+}
+
+// wait() waits for the interval, answering false if ctx is
+// done first.
+func (p *poller) wait(ctx context.Context) bool {
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// lastOr() answers the most recent failed comparison, or else the
+// most recent error, or err if there is neither.
+func (p *poller) lastOr(err error) error {
+	if p.last != nil {
+		return p.last
+	} else if p.lastErr != nil {
+		return p.lastErr
+	}
+	return err
+}
+
+// finish() answers err with the attempt count and elapsed time.
+func (p *poller) finish(err error) error {
+	elapsed := time.Since(p.start)
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		c := *ce
+		c.attempts = p.attempts
+		c.elapsed = elapsed
+		return &c
+	}
+	var ee *EvaluationError
+	if errors.As(err, &ee) {
+		err = ee.err
+	}
+	return newEvaluationError(fmt.Errorf(attemptsFmt+": %w", p.attempts, elapsed.Round(time.Millisecond), err))
+}
+
+// ignoreContext() adapts a fetch that doesn't take a context.
+func ignoreContext(fetch func() (interface{}, error)) func(context.Context) (interface{}, error) {
+	return func(context.Context) (interface{}, error) {
+		return fetch()
+	}
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	defaultPollInterval = 100 * time.Millisecond
+)
+
+const (
+	attemptsFmt = "after %v attempt(s) in %v"
+	fetchErrFmt = "jacl: fetch: %w"
+)
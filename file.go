@@ -0,0 +1,340 @@
+package jacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ------------------------------------------------------------
+// LOAD
+
+// LoadFile loads an expectation file and answers the Cmper it
+// describes. Files are JSON or YAML objects with one of these fields:
+//
+//	"cmp":  A single expected item, as passed to Cmp().
+//	"cmps": A list of expected items, as passed to Cmps().
+//	"nil":  true, for CmpNil().
+//
+// Along with these optional fields:
+//
+//	"key":       ["id"], see Key(). cmps only.
+//	"notExists": [["owner", "password"], "token"], see NotExists().
+//	             Each entry is a path, or a single field name.
+//	"sizeIs":    3, or {"size": 3, "path": ["items"]}, see SizeIs().
+//	"allErrors": true, see AllErrors().
+//	"tolerance": {"abs": 0.001, "rel": 0}, see Tolerance().
+//	"unordered": true, see Unordered().
+//	"strict":    true, or a list of open paths, see Strict().
+//
+// Matchers are written as objects with a "$jacl" field naming the
+// matcher, plus the matcher's fields, for example
+// {"$jacl": "regex", "pattern": "^u_"}. The names are the factory
+// keys, without the "jacl-" prefix for built-in matchers: any,
+// regex (pattern), oneof (values), range (min, max), approx (value,
+// abs, rel), prefix (prefix), suffix (suffix), contains (substr),
+// notempty, typeis (type), isnull, ismissing and isnullormissing.
+//
+// Errors are answered as a *LoadError that locates the problem.
+func LoadFile(filename string) (Cmper, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return load(filename, data)
+}
+
+// Load is LoadFile for an expectation that is already in memory.
+func Load(data []byte) (Cmper, error) {
+	return load("", data)
+}
+
+func load(filename string, data []byte) (Cmper, error) {
+	l := loader{filename: filename}
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, &LoadError{File: filename, Err: err}
+	}
+	if len(doc.Content) < 1 {
+		return nil, l.errorf(&doc, "", "empty expectation")
+	}
+	return l.expectation(doc.Content[0])
+}
+
+// ------------------------------------------------------------
+// LOADER
+
+// loader converts the nodes of an expectation file into a Cmper.
+type loader struct {
+	filename string
+}
+
+func (l loader) expectation(n *yaml.Node) (Cmper, error) {
+	if n.Kind != yaml.MappingNode {
+		return nil, l.errorf(n, "", "want object")
+	}
+	var single, slice interface{}
+	var isSingle, isSlice, isNil, hasKey bool
+	var fns, opts []interface{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		field, vn := n.Content[i].Value, n.Content[i+1]
+		var err error
+		switch field {
+		case "cmp":
+			isSingle = true
+			single, err = l.value(vn, field)
+		case "cmps":
+			isSlice = true
+			if vn.Kind != yaml.SequenceNode {
+				return nil, l.errorf(vn, field, "want array")
+			}
+			slice, err = l.value(vn, field)
+		case "nil":
+			isNil, err = l.bool(vn, field)
+		case "key":
+			var keys []string
+			keys, err = l.strings(vn, field)
+			fns = append(fns, Key(keys...))
+			hasKey = true
+		case "notExists":
+			if vn.Kind != yaml.SequenceNode {
+				return nil, l.errorf(vn, field, "want array")
+			}
+			for j, pn := range vn.Content {
+				var path []string
+				if pn.Kind == yaml.ScalarNode {
+					path = []string{pn.Value}
+				} else {
+					path, err = l.strings(pn, joinIndex(field, j))
+					if err != nil {
+						return nil, err
+					}
+				}
+				fns = append(fns, NotExists(path...))
+			}
+		case "sizeIs":
+			if vn.Kind == yaml.MappingNode {
+				var s struct {
+					Size int      `json:"size"`
+					Path []string `json:"path"`
+				}
+				err = l.decode(vn, field, &s)
+				fns = append(fns, SizeIs(s.Size, s.Path...))
+				break
+			}
+			var size int
+			size, err = strconv.Atoi(vn.Value)
+			if err != nil || vn.Tag != "!!int" {
+				return nil, l.errorf(vn, field, "want integer")
+			}
+			fns = append(fns, SizeIs(size))
+		case "allErrors":
+			var b bool
+			if b, err = l.bool(vn, field); b {
+				opts = append(opts, AllErrors())
+			}
+		case "tolerance":
+			var t struct {
+				Abs float64 `json:"abs"`
+				Rel float64 `json:"rel"`
+			}
+			err = l.decode(vn, field, &t)
+			opts = append(opts, Tolerance(t.Abs, t.Rel))
+		case "unordered":
+			var b bool
+			if b, err = l.bool(vn, field); b {
+				opts = append(opts, Unordered())
+			}
+		case "strict":
+			if vn.Kind == yaml.SequenceNode {
+				var open []string
+				open, err = l.strings(vn, field)
+				opts = append(opts, Strict(open...))
+			} else {
+				var b bool
+				if b, err = l.bool(vn, field); b {
+					opts = append(opts, Strict())
+				}
+			}
+		default:
+			return nil, l.errorf(n.Content[i], field, "unknown field")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case isSingle && !isSlice && !isNil:
+		if hasKey {
+			return nil, l.errorf(n, "cmp", "key requires cmps")
+		}
+		return Cmp(single, append(fns, opts...)...), nil
+	case isSlice && !isSingle && !isNil:
+		args := append(fns, opts...)
+		args = append(args, slice.([]interface{})...)
+		return Cmps(args...), nil
+	case isNil && !isSingle && !isSlice:
+		return CmpNil(), nil
+	}
+	return nil, l.errorf(n, "", "want exactly one of cmp, cmps or nil")
+}
+
+// value() converts a node into a generic JSON value,
+// validating any matchers.
+func (l loader) value(n *yaml.Node, path string) (interface{}, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return l.value(n.Alias, path)
+	case yaml.MappingNode:
+		m := make(map[string]interface{})
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			kn, vn := n.Content[i], n.Content[i+1]
+			if kn.Kind != yaml.ScalarNode {
+				return nil, l.errorf(kn, path, "want string key")
+			}
+			v, err := l.value(vn, joinKey(path, kn.Value))
+			if err != nil {
+				return nil, err
+			}
+			m[kn.Value] = v
+		}
+		return l.matcher(n, path, m)
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for i, vn := range n.Content {
+			v, err := l.value(vn, joinIndex(path, i))
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			return l.bool(n, path)
+		case "!!int", "!!float":
+			if !json.Valid([]byte(n.Value)) {
+				return nil, l.errorf(n, path, "invalid number %v", n.Value)
+			}
+			return json.Number(n.Value), nil
+		}
+		return n.Value, nil
+	}
+	return nil, l.errorf(n, path, "unsupported value")
+}
+
+// matcher() validates m if it is a matcher, expanding the short
+// names of the built-in matchers.
+func (l loader) matcher(n *yaml.Node, path string, m map[string]interface{}) (interface{}, error) {
+	v, ok := m[matcherMarker]
+	if !ok {
+		return m, nil
+	}
+	key, ok := v.(string)
+	if !ok {
+		return nil, l.errorf(n, joinKey(path, matcherMarker), "want string")
+	}
+	if _, err := newRegistered(key); err != nil {
+		if _, err = newRegistered(builtinPrefix + key); err == nil {
+			m[matcherMarker] = builtinPrefix + key
+		}
+	}
+	if _, _, err := asMatcher(m); err != nil {
+		return nil, l.errorf(n, path, "%v", err)
+	}
+	return m, nil
+}
+
+func (l loader) bool(n *yaml.Node, path string) (bool, error) {
+	var b bool
+	if n.Tag != "!!bool" || n.Decode(&b) != nil {
+		return false, l.errorf(n, path, "want bool")
+	}
+	return b, nil
+}
+
+func (l loader) strings(n *yaml.Node, path string) ([]string, error) {
+	if n.Kind != yaml.SequenceNode {
+		return nil, l.errorf(n, path, "want array of strings")
+	}
+	var s []string
+	for _, vn := range n.Content {
+		if vn.Kind != yaml.ScalarNode {
+			return nil, l.errorf(vn, path, "want string")
+		}
+		s = append(s, vn.Value)
+	}
+	return s, nil
+}
+
+// decode() decodes a node into a struct, by way of JSON
+// so the struct's json tags are honored.
+func (l loader) decode(n *yaml.Node, path string, dst interface{}) error {
+	v, err := l.value(n, path)
+	if err != nil {
+		return err
+	}
+	err = toFromJson(v, dst)
+	if err != nil {
+		return l.errorf(n, path, "%v", err)
+	}
+	return nil
+}
+
+func (l loader) errorf(n *yaml.Node, field, format string, args ...interface{}) error {
+	return &LoadError{File: l.filename, Line: n.Line, Column: n.Column, Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+// ------------------------------------------------------------
+// LOAD-ERROR
+
+// LoadError describes a problem in an expectation file.
+type LoadError struct {
+	File   string // The file name, if the expectation came from a file
+	Line   int    // The line of the problem, starting at 1, or 0 if unknown
+	Column int    // The column of the problem, starting at 1, or 0 if unknown
+	Field  string // The path to the field with the problem, if any
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	var loc []string
+	if e.File != "" {
+		loc = append(loc, e.File)
+	}
+	if e.Line > 0 {
+		loc = append(loc, strconv.Itoa(e.Line), strconv.Itoa(e.Column))
+	}
+	var sb strings.Builder
+	if len(loc) > 0 {
+		sb.WriteString(strings.Join(loc, ":"))
+		sb.WriteString(": ")
+	}
+	if e.Field != "" {
+		sb.WriteString(e.Field)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Err.Error())
+	return sb.String()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// The prefix of the built-in factory keys.
+	builtinPrefix = "jacl-"
+)
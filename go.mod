@@ -10,4 +10,5 @@ require (
 	github.com/yuin/goldmark v1.1.33 // indirect
 	golang.org/x/net v0.0.0-20200707034311-ab3426394381 // indirect
 	golang.org/x/tools v0.0.0-20200711155855-7342f9734a7d // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
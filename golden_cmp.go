@@ -0,0 +1,138 @@
+package jacl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ------------------------------------------------------------
+// GOLDEN-CMP
+
+// goldenCmp compares against the contents of a golden file,
+// optionally updating the file with the compared value.
+type goldenCmp struct {
+	Filename string  `json:"filename,omitempty"`
+	Prune    bool    `json:"prune,omitempty"`
+	Update   bool    `json:"update,omitempty"`
+	Opts     cmpOpts `json:"opts,omitempty"`
+}
+
+func (c goldenCmp) Cmp(b interface{}) error {
+	bv, err := normalize(b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	fn := goldenFilename(c.Filename)
+	want, err := readGolden(fn)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return newEvaluationError(err)
+	}
+
+	if c.Update || updateGolden() {
+		if c.Prune && err == nil {
+			bv = prune(bv, want)
+		}
+		return writeGolden(fn, bv)
+	}
+
+	if err != nil {
+		return newEvaluationError(fmt.Errorf("missing golden file %v, set %v=1 to create it", fn, updateGoldenEnv))
+	}
+	return singleCmp{A: want, Opts: c.Opts}.Cmp(bv)
+}
+
+func (c goldenCmp) SerializeKey() string {
+	return goldenCmpFactoryKey
+}
+
+// goldenFilename() answers the path to a golden file. Plain
+// file names are placed in ./testdata.
+func goldenFilename(fn string) string {
+	if filepath.Dir(fn) == "." {
+		return filepath.Join("./testdata", fn)
+	}
+	return fn
+}
+
+func readGolden(fn string) (interface{}, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = unmarshalJson(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf("golden file %v: %w", fn, err)
+	}
+	return v, nil
+}
+
+func writeGolden(fn string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	err = os.MkdirAll(filepath.Dir(fn), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(fn, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	return nil
+}
+
+// updateGolden() answers true if the environment requests
+// that golden files be updated.
+func updateGolden() bool {
+	b, _ := strconv.ParseBool(os.Getenv(updateGoldenEnv))
+	return b
+}
+
+// prune() answers v with everything removed that is not in shape.
+// Slice elements are pruned against the element at the same index
+// in shape, or the last one when v is longer.
+func prune(v, shape interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		st, ok := shape.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		m := make(map[string]interface{})
+		for k, sv := range st {
+			if vv, ok := vt[k]; ok {
+				m[k] = prune(vv, sv)
+			}
+		}
+		return m
+	case []interface{}:
+		st, ok := shape.([]interface{})
+		if !ok || len(st) < 1 {
+			return v
+		}
+		s := make([]interface{}, 0, len(vt))
+		for i, vv := range vt {
+			if i >= len(st) {
+				s = append(s, prune(vv, st[len(st)-1]))
+			} else {
+				s = append(s, prune(vv, st[i]))
+			}
+		}
+		return s
+	}
+	return v
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// Set this environment variable to true to update golden files.
+	updateGoldenEnv = "JACL_UPDATE"
+)
@@ -0,0 +1,199 @@
+package jacl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// HTTP-CMP
+
+// httpCmp compares the status, headers and body of an HTTP response.
+type httpCmp struct {
+	Status  int          `json:"status,omitempty"`
+	Headers Fields       `json:"headers,omitempty"`
+	Body    CmperFactory `json:"body,omitempty"`
+}
+
+func (c httpCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+func (c httpCmp) cmpScoped(b interface{}, sc *varScope) error {
+	resp, err := toHttpResponse(b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+
+	// Each section is independent, so report them all.
+	s := newCmpState(cmpOpts{All: true})
+	if c.Status != 0 && resp.StatusCode != c.Status {
+		s.fail(newMismatchError(httpStatusPath, ReasonValue, c.Status, resp.StatusCode))
+	}
+	for _, k := range sortedKeys(c.Headers) {
+		path := joinKey(httpHeaderPath, k)
+		want, err := normalize(c.Headers[k])
+		if err != nil {
+			return newEvaluationError(err)
+		}
+		values, ok := resp.Header[http.CanonicalHeaderKey(k)]
+		if !ok {
+			// Let IsMissing() and friends decide about absent headers.
+			s.compareMember(path, want, nil, false)
+			continue
+		}
+		compareHeader(s, path, want, values)
+	}
+	if c.Body.Cmper == nil {
+		return s.err()
+	}
+
+	body, err := readHttpBody(resp)
+	if err != nil {
+		return prefixError(err, httpBodyPath)
+	}
+	err = prefixError(c.Body.cmpScoped(body, sc), httpBodyPath)
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		for _, m := range ce.Mismatches() {
+			s.fail(m)
+		}
+		s.setRoot(ce.rootA, ce.rootB)
+		s.pairs = ce.rootPairs
+		s.rootOpts = ce.rootOpts
+	} else if err != nil {
+		return err
+	}
+	return s.err()
+}
+
+func (c httpCmp) SerializeKey() string {
+	return httpCmpFactoryKey
+}
+
+// compareHeader() compares want to the values of a header. A list is
+// compared to all of the values, in order. Anything else must match
+// one of the values.
+func compareHeader(s *cmpState, path string, want interface{}, values []string) {
+	if list, ok := want.([]interface{}); ok {
+		have := make([]interface{}, 0, len(values))
+		for i, v := range values {
+			var w interface{}
+			if i < len(list) {
+				w = list[i]
+			}
+			have = append(have, headerValue(w, v))
+		}
+		s.compare(path, list, have)
+		return
+	}
+	if len(values) == 1 {
+		s.compare(path, want, headerValue(want, values[0]))
+		return
+	}
+	for _, v := range values {
+		if ok, _ := s.probe(want, headerValue(want, v)); ok {
+			return
+		}
+	}
+	s.fail(newMismatchError(path, ReasonValue, want, values))
+}
+
+// headerValue() answers the header value v as the type of want, so
+// a number or bool can be compared to the text of the header. Values
+// that can't be converted are left as strings.
+func headerValue(want interface{}, v string) interface{} {
+	switch want.(type) {
+	case json.Number:
+		// Only accept JSON number syntax, unlike ParseFloat.
+		var f float64
+		if json.Unmarshal([]byte(v), &f) == nil {
+			return json.Number(v)
+		}
+	case bool:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// toHttpResponse() answers the response in b, which is an
+// *http.Response or a recorder, such as httptest.ResponseRecorder.
+func toHttpResponse(b interface{}) (*http.Response, error) {
+	switch t := b.(type) {
+	case *http.Response:
+		if t != nil {
+			return t, nil
+		}
+	case interface{ Result() *http.Response }:
+		if t != nil {
+			return t.Result(), nil
+		}
+	}
+	return nil, fmt.Errorf("want *http.Response or recorder, have %T", b)
+}
+
+// readHttpBody() reads and decodes the response body according to the
+// Content-Type. JSON is decoded, forms become objects, and everything
+// else is a string. The body is replaced so it can be read again.
+func readHttpBody(resp *http.Response) (interface{}, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		var v interface{}
+		err = unmarshalJson(data, &v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return v, nil
+	case mt == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, err
+		}
+		form := make(map[string]interface{})
+		for k, v := range values {
+			if len(v) == 1 {
+				form[k] = v[0]
+			} else {
+				form[k] = v
+			}
+		}
+		return form, nil
+	case mt == "":
+		// Without a Content-Type, accept JSON if that's what it is.
+		var v interface{}
+		if unmarshalJson(data, &v) == nil {
+			return v, nil
+		}
+	}
+	return string(data), nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	httpStatusPath = "status"
+	httpHeaderPath = "header"
+	httpBodyPath   = "body"
+)
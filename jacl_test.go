@@ -1,8 +1,20 @@
 package jacl
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // ------------------------------------------------------------
@@ -21,7 +33,7 @@ func TestCompare(t *testing.T) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			haveResp := compare(tc.A, tc.B)
+			haveResp := compare("", tc.A, tc.B) == nil
 			if haveResp != tc.WantResp {
 				fmt.Printf("have %v want %v\n", toJson(tc.B), toJson(tc.A))
 				t.Fatal()
@@ -30,24 +42,1186 @@ func TestCompare(t *testing.T) {
 	}
 }
 
+// ------------------------------------------------------------
+// TEST-COMPARISON-ERROR
+
+func TestComparisonError(t *testing.T) {
+	cases := []struct {
+		Cmp        Cmper
+		B          interface{}
+		WantPath   string
+		WantReason Reason
+		WantMsg    string
+	}{
+		{Cmp("a"), "b", "", ReasonValue, `have "b" want "a"`},
+		{Cmp(AT{A: "a"}), AT{A: "b"}, "a", ReasonValue, `a: have "b" want "a"`},
+		{Cmp(AT{A: AT{A: "a"}}), AT{A: AT{A: 1}}, "a.a", ReasonType, `a.a: have 1 want "a"`},
+		{Cmp(AT{A: AT{A: "a"}}), AT{A: BT{B: "b"}}, "a.a", ReasonMissing, `a.a: missing, want "a"`},
+		{Cmp(AT{A: []string{"a"}}), AT{A: []string{"a", "b"}}, "a", ReasonLength, `a: have length 2 want length 1`},
+		{Cmp(F("a.b", "c")), F("a.b", "d"), `["a.b"]`, ReasonValue, `["a.b"]: have "d" want "c"`},
+		{Cmps(AT{A: "a"}, AT{A: []string{"b"}}), []interface{}{AT{A: "a"}, AT{A: []string{"c"}}}, "[1].a[0]", ReasonValue, `[1].a[0]: have "c" want "b"`},
+		{Cmps(Key("a"), BT{A: "a", B: "b"}), []interface{}{AT{A: "c"}, BT{A: "a", B: "c"}}, "[1].b", ReasonValue, `[1].b: have "c" want "b"`},
+		{Cmps(Key("a"), BT{A: "a", B: "b"}), []interface{}{AT{A: "c"}}, "[0]", ReasonMissing, `[0]: missing, want {"a":"a","b":"b"}`},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := tc.Cmp.Cmp(tc.B)
+			var ce *ComparisonError
+			if !errors.As(err, &ce) {
+				fmt.Printf("have err %v want ComparisonError\n", err)
+				t.Fatal()
+			} else if ce.Path() != tc.WantPath {
+				fmt.Printf("have path %v want %v\n", ce.Path(), tc.WantPath)
+				t.Fatal()
+			} else if ce.Reason() != tc.WantReason {
+				fmt.Printf("have reason %v want %v\n", ce.Reason(), tc.WantReason)
+				t.Fatal()
+			} else if ce.Error() != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", ce.Error(), tc.WantMsg)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-ALL-ERRORS
+
+func TestAllErrors(t *testing.T) {
+	cases := []struct {
+		Cmp       Cmper
+		B         interface{}
+		WantPaths []string
+	}{
+		{Cmp(BT{A: "a", B: "b"}, AllErrors()), BT{A: "a", B: "b"}, nil},
+		{Cmp(BT{A: "a", B: "b"}), BT{A: "c", B: "d"}, []string{"a"}},
+		{Cmp(BT{A: "a", B: "b"}, AllErrors()), BT{A: "c", B: "d"}, []string{"a", "b"}},
+		{Cmp(BT{A: "a", B: AT{A: "b"}}, AllErrors()), BT{A: "c"}, []string{"a", "b"}},
+		{Cmps(AT{A: "a"}, AT{A: "b"}, AllErrors()), []interface{}{AT{A: "c"}, AT{A: "d"}}, []string{"[0].a", "[1].a"}},
+		{Cmps(Key("a"), BT{A: "a", B: "b"}, BT{A: "c", B: "d"}, AllErrors()), []interface{}{BT{A: "a", B: "x"}}, []string{"[0].b", "[1]"}},
+		{Cmps(NotExists("b"), AT{A: "a"}, AllErrors()), []interface{}{BT{A: "c", B: "d"}}, []string{"[0].b", "[0].a"}},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := tc.Cmp.Cmp(tc.B)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(err, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			} else if err != nil {
+				fmt.Printf("have err %v want ComparisonError\n", err)
+				t.Fatal()
+			}
+			if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-DIFF
+
+func TestDiff(t *testing.T) {
+	// Diffs are colored when stdout is a terminal.
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	cases := []struct {
+		Cmp      Cmper
+		B        interface{}
+		WantDiff string
+	}{
+		{Cmp("a"), "b", "- \"a\"\n+ \"b\"\n"},
+		{Cmp(AT{A: "a"}), BT{A: "b", B: "c"}, "  {\n-   \"a\": \"a\",\n+   \"a\": \"b\",\n    … 1 more fields\n  }\n"},
+		{Cmp(BT{A: "a", B: "b"}), AT{A: "a"}, "  {\n    \"a\": \"a\",\n-   \"b\": \"b\"\n  }\n"},
+		{Cmps(AT{A: "a"}), []interface{}{AT{A: "b"}, AT{A: "c"}}, "  [\n    {\n-     \"a\": \"a\"\n+     \"a\": \"b\"\n    },\n    … 1 more items\n  ]\n"},
+		// Keyed and unordered items are shown beside the item they matched.
+		{Cmps(Key("id"), F("id", 2, "n", "x")), []interface{}{F("id", 1, "n", "a"), F("id", 2, "n", "b")}, "  [\n    {\n      \"id\": 2,\n-     \"n\": \"x\"\n+     \"n\": \"b\"\n    },\n    … 1 more items\n  ]\n"},
+		{Cmps(Key("id"), F("id", 3), F("id", 1, "n", "a")), []interface{}{F("id", 1, "n", "a"), F("id", 2)}, "  [\n-   {\n-     \"id\": 3\n-   },\n    {\n      \"id\": 1,\n      \"n\": \"a\"\n    },\n    … 1 more items\n  ]\n"},
+		{Cmps(F("a", "c"), F("a", "b"), Unordered()), []interface{}{F("a", "b"), F("a", "x")}, "  [\n-   {\n-     \"a\": \"c\"\n-   },\n    {\n      \"a\": \"b\"\n    },\n    … 1 more items\n  ]\n"},
+		// Values accepted by the tolerance are unchanged.
+		{Cmp(F("a", 1.0, "b", "x"), Tolerance(0.1, 0)), F("a", 1.05, "b", "y"), "  {\n    \"a\": 1,\n-   \"b\": \"x\"\n+   \"b\": \"y\"\n  }\n"},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := tc.Cmp.Cmp(tc.B)
+			var ce *ComparisonError
+			if !errors.As(err, &ce) {
+				fmt.Printf("have err %v want ComparisonError\n", err)
+				t.Fatal()
+			}
+			haveDiff := ce.Diff()
+			if haveDiff != tc.WantDiff {
+				fmt.Printf("have diff\n%v\nwant\n%v\n", haveDiff, tc.WantDiff)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-STRICT
+
+func TestStrict(t *testing.T) {
+	cases := []struct {
+		Cmp       Cmper
+		B         interface{}
+		WantPaths []string
+	}{
+		{Cmp(BT{A: "a", B: "b"}, Strict()), BT{A: "a", B: "b"}, nil},
+		{Cmp(AT{A: "a"}), BT{A: "a", B: "b"}, nil},
+		{Cmp(AT{A: "a"}, Strict()), BT{A: "a", B: "b"}, []string{"b"}},
+		{Cmp(AT{A: AT{A: "a"}}, Strict()), AT{A: BT{A: "a", B: "b"}}, []string{"a.b"}},
+		{Cmp(AT{A: AT{A: "a"}}, Strict("a")), AT{A: BT{A: "a", B: "b"}}, nil},
+		{Cmp(BT{A: "a", B: AT{A: "a"}}, Strict("b"), AllErrors()), F("a", "a", "b", BT{A: "a", B: "b"}, "c", "c"), []string{"c"}},
+		{Cmps(AT{A: "a"}, Strict()), []interface{}{AT{A: "a"}, AT{A: "b"}}, []string{"[1]"}},
+		{Cmps(AT{A: "a"}, Strict()), []interface{}{BT{A: "a", B: "b"}}, []string{"[0].b"}},
+		{Cmps(AT{A: "a"}, Strict("[*].b")), []interface{}{BT{A: "a", B: "b"}}, nil},
+		{Cmps(Key("a"), AT{A: "a"}, Strict()), []interface{}{AT{A: "c"}, AT{A: "a"}}, []string{"[0]"}},
+		{Cmps(Unordered(), "a", Strict()), []interface{}{"b", "a"}, []string{"[0]"}},
+		{Cmp(AT{A: []string{"a"}}, Unordered(), Strict()), AT{A: []string{"b", "a"}}, []string{"a"}},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := tc.Cmp.Cmp(tc.B)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(err, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			} else if err != nil {
+				fmt.Printf("have err %v want ComparisonError\n", err)
+				t.Fatal()
+			}
+			if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			}
+		})
+	}
+}
+
 // ------------------------------------------------------------
 // TEST-NIL-CMP
 
-func TestNilCmp(t *testing.T) {
+func TestNilCmp(t *testing.T) {
+	cases := []struct {
+		B       interface{}
+		WantErr error
+	}{
+		{nil, nil},
+		{"a", cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := CmpNil()
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SINGLE-CMP
+
+func TestSingleCmp(t *testing.T) {
+	cases := []struct {
+		A       interface{}
+		B       interface{}
+		WantErr error
+	}{
+		{"a", "a", nil},
+		{"a", "b", cmpErr},
+		{AT{A: "a"}, AT{A: "a"}, nil},
+		{AT{A: "a"}, AT{A: "b"}, cmpErr},
+		{AT{A: "a"}, BT{A: "a"}, nil},
+		{AT{A: "a"}, BT{A: "a", B: "b"}, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := Cmp(tc.A)
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SINGLE-FUNCS
+
+func TestSingleFuncs(t *testing.T) {
+	user := F("id", 1, "owner", F("name", "a", "hash", "x"), "items", []int{1, 2})
+	load := func(s string) Cmper {
+		c, err := Load([]byte(s))
+		if err != nil {
+			panic(err)
+		}
+		return c
+	}
+	cases := []struct {
+		Cmp       Cmper
+		B         interface{}
+		WantErr   error
+		WantPaths []string
+	}{
+		{Cmp(F("id", 1), NotExists("password")), user, nil, nil},
+		{Cmp(F("id", 1), NotExists("owner", "hash")), user, cmpErr, []string{"owner.hash"}},
+		{Cmp(F("id", 1), NotExists("items", "1")), user, cmpErr, []string{"items[1]"}},
+		{Cmp(nil, NotExists("owner", "hash")), user, cmpErr, []string{"owner.hash"}},
+		{Cmp(nil, NotExists("password")), user, nil, nil},
+		// Scalars along the path have no fields.
+		{Cmp(nil, NotExists("a", "b")), F("a", 1), nil, nil},
+		{Cmp(nil, NotExists("a", "b")), F("a", true), nil, nil},
+		{Cmp(nil, NotExists("a", "b", "c")), F("a", F("b", 1.5)), nil, nil},
+		{Cmp(nil, NotExists("a", "b")), F("a", nil), nil, nil},
+		{Cmp(nil, NotExists("a", "b")), 1, nil, nil},
+		{Cmp(F("id", 1), SizeIs(2, "items")), user, nil, nil},
+		{Cmp(F("id", 1), SizeIs(3, "items")), user, cmpErr, []string{"items"}},
+		{Cmp(F("id", 1), SizeIs(3, "missing")), user, cmpErr, []string{"missing"}},
+		{Cmp(F("id", 1), SizeIs(3, "id")), user, cmpErr, []string{"id"}},
+		{Cmp(F("id", 2), NotExists("owner", "hash"), AllErrors()), user, cmpErr, []string{"owner.hash", "id"}},
+		// A list is evaluated as Cmps() would.
+		{Cmp([]interface{}{"a", "b"}, SizeIs(2)), []string{"a", "b"}, nil, nil},
+		{Cmp([]interface{}{"a", "b"}, SizeIs(3)), []string{"a", "b"}, cmpErr, []string{""}},
+		// Expectation files accept the funcs with cmp.
+		{load("cmp: {id: 1}\nnotExists: [[owner, hash]]"), user, cmpErr, []string{"owner.hash"}},
+		{load("cmp: {id: 1}\nsizeIs: {size: 2, path: [items]}"), user, nil, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			// Run through the factory so the funcs are serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: tc.Cmp}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			}
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			} else if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-INCLUDE-ZERO
+
+func TestIncludeZero(t *testing.T) {
+	zeros := F("deleted", false, "count", 0, "name", "")
+	cases := []struct {
+		Cmp     Cmper
+		B       interface{}
+		WantErr error
+	}{
+		// Without the option, zero fields are not compared.
+		{Cmp(ZT{}), F("deleted", true), nil},
+		{Cmp(ZT{}, IncludeZero()), F("deleted", true, "count", 0, "name", ""), cmpErr},
+		{Cmp(ZT{}, IncludeZero()), zeros, nil},
+		{Cmp(ZT{}, IncludeZero()), F("count", 0, "name", ""), cmpErr},
+		{Cmp(ZT{}, IncludeZero()), ZT{}, nil},
+		{Cmp(ZT{Owner: &AT{}}, IncludeZero()), F("deleted", false, "count", 0, "name", "", "owner", F()), nil},
+		{Cmps(IncludeZero(), ZT{Name: "a"}), []interface{}{F("deleted", true, "count", 0, "name", "a")}, cmpErr},
+		{Cmps(IncludeZero(), ZT{Name: "a"}), []interface{}{F("deleted", false, "count", 0, "name", "a")}, nil},
+		// The required tag always keeps the field.
+		{Cmp(RT{}), F("deleted", true), cmpErr},
+		{Cmp(RT{}), F("deleted", false), nil},
+		{Cmp(RT{}), RT{}, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			// Run through the factory so the zeros survive serializing.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: tc.Cmp}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-NULL-MISSING
+
+func TestNullMissing(t *testing.T) {
+	cases := []struct {
+		A          interface{}
+		B          interface{}
+		WantReason Reason
+		WantMsg    string
+	}{
+		{F("a", nil), F("a", nil), ReasonUnknown, ""},
+		{F("a", nil), F(), ReasonMissing, "a: missing, want null"},
+		{F("a", nil), F("a", 1), ReasonType, "a: have 1 want null"},
+		{F("a", IsNull()), F("a", nil), ReasonUnknown, ""},
+		{F("a", IsNull()), F(), ReasonMissing, "a: missing, want null"},
+		{F("a", IsNull()), F("a", 1), ReasonType, "a: have 1 want null"},
+		{F("a", IsMissing()), F(), ReasonUnknown, ""},
+		{F("a", IsMissing()), F("a", nil), ReasonExists, "a: have null want missing"},
+		{F("a", IsMissing()), F("a", "x"), ReasonExists, `a: have "x" want missing`},
+		{F("a", IsNullOrMissing()), F(), ReasonUnknown, ""},
+		{F("a", IsNullOrMissing()), F("a", nil), ReasonUnknown, ""},
+		{F("a", IsNullOrMissing()), F("a", 1), ReasonType, "a: have 1 want null or missing"},
+		// Nested, and in serialized form.
+		{F("a", F("b", IsMissing())), F("a", F("c", 1)), ReasonUnknown, ""},
+		{F("a", F("b", nil)), F("a", F("c", 1)), ReasonMissing, "a.b: missing, want null"},
+		{JSON([]byte(`{"a": {"$jacl": "jacl-isnull"}}`)), F(), ReasonMissing, "a: missing, want null"},
+		{JSON([]byte(`{"a": {"$jacl": "jacl-ismissing"}}`)), F(), ReasonUnknown, ""},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			// Run through the factory so the markers are serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: Cmp(tc.A)}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
+			haveReason, haveMsg := ReasonUnknown, ""
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				haveReason, haveMsg = ce.Reason(), ce.Error()
+			} else if haveErr != nil {
+				t.Fatal(haveErr)
+			}
+			if haveReason != tc.WantReason || haveMsg != tc.WantMsg {
+				fmt.Printf("have %v %v want %v %v\n", haveReason, haveMsg, tc.WantReason, tc.WantMsg)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-MATCHERS
+
+func TestMatchers(t *testing.T) {
+	cases := []struct {
+		A       interface{}
+		B       interface{}
+		WantErr error
+	}{
+		{Any(), "a", nil},
+		{F("a", Any()), F("a", nil), nil},
+		{F("a", Any()), F("b", "b"), cmpErr},
+		{F("a", Regex("^[a-z]+$")), F("a", "abc"), nil},
+		{F("a", Regex("^[a-z]+$")), F("a", "ab1"), cmpErr},
+		{F("a", Regex("^[a-z]+$")), F("a", 1), cmpErr},
+		{F("a", F("$jacl", "jacl-regex", "pattern", "^[a-z]+$")), F("a", "abc"), nil},
+		{F("a", F("$jacl", "jacl-regex", "pattern", "^[a-z]+$")), F("a", "ab1"), cmpErr},
+		{F("a", F("$jacl", "jacl-regex", "pattern", "[a-z")), F("a", "abc"), evalErr},
+		{[]interface{}{"a", F("$jacl", "jacl-regex", "pattern", "[a-z")}, []interface{}{"a", "b"}, evalErr},
+		{F("a", OneOf("a", "b")), F("a", "b"), nil},
+		{F("a", OneOf("a", "b")), F("a", "c"), cmpErr},
+		{F("a", OneOf(AT{A: "a"})), F("a", BT{A: "a", B: "b"}), nil},
+		{F("a", Range(1, 2)), F("a", 1.5), nil},
+		{F("a", Range(1, 2)), F("a", 3), cmpErr},
+		{F("a", Range(0, 9007199254740992)), F("a", json.Number("9007199254740993")), cmpErr},
+		{F("a", F("$jacl", "jacl-range", "min", json.Number("9007199254740993"), "max", json.Number("9007199254740995"))), F("a", json.Number("9007199254740993")), nil},
+		{F("a", F("$jacl", "jacl-range", "min", json.Number("9007199254740993"), "max", json.Number("9007199254740995"))), F("a", json.Number("9007199254740992")), cmpErr},
+		{F("a", Prefix("ab")), F("a", "abc"), nil},
+		{F("a", Prefix("ab")), F("a", "cab"), cmpErr},
+		{F("a", Suffix("bc")), F("a", "abc"), nil},
+		{F("a", Suffix("bc")), F("a", "bca"), cmpErr},
+		{F("a", Contains("b")), F("a", "abc"), nil},
+		{F("a", Contains("d")), F("a", "abc"), cmpErr},
+		{F("a", NotEmpty()), F("a", []int{1}), nil},
+		{F("a", NotEmpty()), F("a", ""), cmpErr},
+		{F("a", TypeIs(TypeObject)), F("a", AT{A: "a"}), nil},
+		{F("a", TypeIs(TypeNumber)), F("a", "1"), cmpErr},
+		// Matchers at depth, in structs and slices
+		{AT{A: AT{A: []interface{}{"a", Prefix("b")}}}, AT{A: AT{A: []string{"a", "bc"}}}, nil},
+		{AT{A: AT{A: []interface{}{"a", Prefix("b")}}}, AT{A: AT{A: []string{"a", "cb"}}}, cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveErr := Cmp(tc.A).Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+			// Matchers must survive marshalling.
+			input := CmperFactory{Cmper: Cmp(tc.A)}
+			output := CmperFactory{}
+			err := toFromJson(input, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr = output.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("after marshalling have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-NUMBERS
+
+func TestNumbers(t *testing.T) {
+	cases := []struct {
+		Cmp     Cmper
+		B       interface{}
+		WantErr error
+	}{
+		{Cmp(F("a", 1)), F("a", 1.0), nil},
+		{Cmp(F("a", 0.3)), F("a", addFloat(0.1, 0.2)), cmpErr},
+		{Cmp(F("a", 0.3), Tolerance(1e-9, 0)), F("a", addFloat(0.1, 0.2)), nil},
+		{Cmp(F("a", 100), Tolerance(0, 0.01)), F("a", 100.5), nil},
+		{Cmp(F("a", 100), Tolerance(0, 0.01)), F("a", 102), cmpErr},
+		{Cmps(F("a", 0.3), Tolerance(1e-9, 0)), []interface{}{F("a", addFloat(0.1, 0.2))}, nil},
+		{Cmp(F("a", Approx(0.3, 1e-9, 0))), F("a", addFloat(0.1, 0.2)), nil},
+		{Cmp(F("a", Approx(10, 1, 0))), F("a", 12), cmpErr},
+		{Cmp(F("a", Approx(10, 1, 0))), F("a", "10"), cmpErr},
+		// Integers beyond 2^53 are compared exactly.
+		{Cmp(F("a", uint64(1<<60+1))), F("a", uint64(1<<60+1)), nil},
+		{Cmp(F("a", uint64(1<<60+1))), F("a", uint64(1<<60)), cmpErr},
+		{Cmp(F("a", 1)), F("a", "1"), cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveErr := tc.Cmp.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-INPUTS
+
+func TestInputs(t *testing.T) {
+	cases := []struct {
+		Cmp     Cmper
+		B       interface{}
+		WantErr error
+	}{
+		{Cmp(F("a", "a")), JSON([]byte(`{"a": "a", "b": 1}`)), nil},
+		{Cmp(F("a", "a")), JSON([]byte(`{"a": "b"}`)), cmpErr},
+		{Cmp(JSON([]byte(`{"a": "a"}`))), BT{A: "a", B: "b"}, nil},
+		{Cmp(JSON([]byte(`{"a": {"$jacl": "jacl-prefix", "prefix": "a"}}`))), AT{A: "abc"}, nil},
+		{Cmp("a"), JSON([]byte(`"a"`)), nil},
+		{Cmp(F("a", "a")), json.RawMessage(`{"a": "a"}`), nil},
+		{Cmp(F("a", json.RawMessage(`["a"]`))), F("a", []string{"a"}), nil},
+		{Cmp(F("a", "a")), Reader(strings.NewReader(`{"a": "a"}`)), nil},
+		{Cmps(F("a", "a")), JSON([]byte(`[{"a": "a"}]`)), nil},
+		{Cmps(JSON([]byte(`{"a": "a"}`))), []interface{}{F("a", "a")}, nil},
+		{CmpNil(), JSON([]byte(`null`)), nil},
+		{Cmp(F("a", "a")), JSON([]byte(`{"a": `)), evalErr},
+		{Cmp(F("a", JSON([]byte(`{`)))), F("a", "a"), evalErr},
+		{Cmps(F("a", "a")), json.RawMessage(`[{`), evalErr},
+		{Cmp(F("a", "a")), Reader(errReader{}), evalErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveErr := tc.Cmp.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-NORMALIZE
+
+func TestNormalize(t *testing.T) {
+	n := 5
+	s := "s"
+	cases := []struct {
+		V interface{}
+	}{
+		{nil},
+		{"a"},
+		{true},
+		{int8(-3)},
+		{uint64(18446744073709551615)},
+		{1.5},
+		{float32(0.1)},
+		{1e21},
+		{0.0000001},
+		{[]int{1, 2}},
+		{[2]string{"a", "b"}},
+		{[]byte("abc")},
+		{map[int]string{1: "a"}},
+		{map[textIntKey]int{1: 1}},
+		{&n},
+		{(*int)(nil)},
+		{json.Number("12345678901234567890")},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{NT{Name: "a", Skip: "b", Num: 2, Embedded: Embedded{E: "e", Name: "hidden"}, EmbeddedPtr: &EmbeddedPtr{P: "p"}}},
+		{NT{NumPtr: &n, StrPtr: &s}},
+		{NT{}},
+		{[]interface{}{BT{A: "a"}, map[string]interface{}{"b": []AT{{A: 1}}}}},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var want interface{}
+			err := toFromJson(tc.V, &want)
+			if err != nil {
+				panic(err)
+			}
+			have, err := normalize(tc.V)
+			if err != nil {
+				fmt.Printf("have err %v want %v\n", err, nil)
+				t.Fatal()
+			}
+			if !reflect.DeepEqual(have, want) {
+				fmt.Printf("have %#v want %#v\n", have, want)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// TestNormalizeStringKeys checks that a map key of a string kind is
+// used as is, even with a text encoding. This is encoding/json's rule,
+// but it can't be compared to json.Marshal: the jsonv2 experiment
+// answers the text encoding instead.
+func TestNormalizeStringKeys(t *testing.T) {
+	have, err := normalize(map[textKey]int{"k": 1})
+	if err != nil {
+		fmt.Printf("have err %v want %v\n", err, nil)
+		t.Fatal()
+	}
+	want := map[string]interface{}{"k": json.Number("1")}
+	if !reflect.DeepEqual(have, want) {
+		fmt.Printf("have %#v want %#v\n", have, want)
+		t.Fatal()
+	}
+}
+
+func TestNormalizeMatchers(t *testing.T) {
+	m := Prefix("a")
+	have, err := normalize(F("a", []interface{}{m}))
+	if err != nil {
+		fmt.Printf("have err %v want %v\n", err, nil)
+		t.Fatal()
+	}
+	if have.(map[string]interface{})["a"].([]interface{})[0] != m {
+		fmt.Printf("have %v want %v\n", have, m)
+		t.Fatal()
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-CMP
+
+func TestSliceCmp(t *testing.T) {
+	cases := []struct {
+		A       []interface{}
+		B       []interface{}
+		WantErr error
+	}{
+		{[]interface{}{"a"}, []interface{}{"a"}, nil},
+		{[]interface{}{"a", "b"}, []interface{}{"a", "b"}, nil},
+		{[]interface{}{"a"}, []interface{}{"b"}, cmpErr},
+		{[]interface{}{AT{A: "a"}}, []interface{}{AT{A: "a"}}, nil},
+		{[]interface{}{AT{A: "a"}}, []interface{}{AT{A: "b"}}, cmpErr},
+		{[]interface{}{AT{A: "a"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
+		{[]interface{}{BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "c"}}, cmpErr},
+		{[]interface{}{Prefix("a"), AT{A: Any()}}, []interface{}{"ab", AT{A: "b"}}, nil},
+		{[]interface{}{BT{A: "a", B: Regex("^b")}}, []interface{}{BT{A: "a", B: "c"}}, cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := Cmps(tc.A...)
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-KEY
+
+func TestSliceKey(t *testing.T) {
+	cases := []struct {
+		A       []interface{}
+		B       []interface{}
+		WantErr error
+	}{
+		{[]interface{}{Key("a"), AT{A: "a"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
+		{[]interface{}{Key("a"), AT{A: "a"}}, []interface{}{AT{A: "-"}, BT{A: "a", B: "b"}}, nil},
+		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
+		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "c"}}, cmpErr},
+		// Everything in A must be in B, even with keys. This is testing unordered comparisons.
+		{[]interface{}{Key("a", "b"), BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "b"}}, cmpErr},
+		// But B can have more than A. This is testing unordered comparisons.
+		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, nil},
+		// Nested keys, dotted and JSON Pointer.
+		{[]interface{}{Key("a.id"), AT{A: F("id", 1)}}, []interface{}{AT{A: F("id", 2)}, BT{A: F("id", 1), B: "b"}}, nil},
+		{[]interface{}{Key("/a/id"), AT{A: F("id", 1)}}, []interface{}{AT{A: F("id", 2)}, BT{A: F("id", 1), B: "b"}}, nil},
+		{[]interface{}{Key("/a/i~1d"), AT{A: F("i/d", 1)}}, []interface{}{AT{A: F("i/d", 1)}}, nil},
+		{[]interface{}{Key("a.id"), AT{A: F("id", 1)}}, []interface{}{AT{A: F("id", 2)}}, cmpErr},
+		// A literal field named by the whole key takes precedence.
+		{[]interface{}{Key("a.id"), F("a.id", 1, "n", "x")}, []interface{}{F("a.id", 2, "n", "y"), F("a.id", 1, "n", "x")}, nil},
+		{[]interface{}{Key("a.id"), F("a.id", 1, "n", "x")}, []interface{}{F("a.id", 1, "n", "y")}, cmpErr},
+		// Key values use the tolerance.
+		{[]interface{}{Key("a"), AT{A: 1.0}, Tolerance(0.01, 0)}, []interface{}{AT{A: 2}, AT{A: 1.001}}, nil},
+		// Keys are compared as values, so objects, numbers and matchers work.
+		{[]interface{}{Key("a"), AT{A: F("id", 1)}}, []interface{}{AT{A: F("id", 2)}, AT{A: F("id", 1, "n", "x")}}, nil},
+		{[]interface{}{Key("a"), AT{A: int64(1)}}, []interface{}{AT{A: 2}, AT{A: json.Number("1")}}, nil},
+		{[]interface{}{Key("a"), AT{A: Prefix("x")}}, []interface{}{AT{A: "a"}, AT{A: "xyz"}}, nil},
+		// Ambiguous keys.
+		{[]interface{}{Key("a"), AT{A: "a"}}, []interface{}{BT{A: "a", B: "1"}, BT{A: "a", B: "2"}}, cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := Cmps(tc.A...)
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestSliceKeyAmbiguous(t *testing.T) {
+	err := Cmps(Key("a.id"), AT{A: F("id", 1)}).Cmp([]interface{}{AT{A: F("id", 1)}, AT{A: F("id", 2)}, AT{A: F("id", 1)}})
+	var ce *ComparisonError
+	if !errors.As(err, &ce) || ce.Reason() != ReasonAmbiguous || ce.Path() != "[0]" {
+		fmt.Printf("have %v want reason %v\n", err, ReasonAmbiguous)
+		t.Fatal()
+	}
+	want := `[0]: ambiguous key {"a.id":1}, matches [0], [2]`
+	if err.Error() != want {
+		fmt.Printf("have %v want %v\n", err.Error(), want)
+		t.Fatal()
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-UNORDERED
+
+func TestSliceUnordered(t *testing.T) {
+	cases := []struct {
+		Cmp       Cmper
+		B         interface{}
+		WantPaths []string
+	}{
+		{Cmps(Unordered(), "a", "b"), []interface{}{"b", "a"}, nil},
+		{Cmps(Unordered(), "a", "b"), []interface{}{"b", "c", "a"}, nil},
+		{Cmps(Unordered(), AT{A: "a"}, BT{A: "b", B: "c"}), []interface{}{BT{A: "b", B: "c"}, BT{A: "a", B: "d"}}, nil},
+		// One B element can't satisfy two A elements.
+		{Cmps(Unordered(), "a", "a"), []interface{}{"a", "b"}, []string{"[1]"}},
+		{Cmps(Unordered(), AllErrors(), "a", "b", "c"), []interface{}{"c"}, []string{"[0]", "[1]"}},
+		// A general match must not steal the partner of a specific one.
+		{Cmps(Unordered(), AT{A: Any()}, BT{A: "a", B: "b"}), []interface{}{BT{A: "a", B: "b"}, AT{A: "c"}}, nil},
+		// Nested slices
+		{Cmp(AT{A: []string{"a", "b"}}, Unordered()), AT{A: []string{"b", "a"}}, nil},
+		{Cmp(AT{A: []string{"a", "b"}}, Unordered()), AT{A: []string{"b", "c", "a"}}, []string{"a"}},
+		{Cmp(AT{A: []string{"a", "b"}}, Unordered()), AT{A: []string{"b", "c"}}, []string{"a[0]"}},
+		{Cmp(AT{A: []string{"a", "b"}}), AT{A: []string{"b", "a"}}, []string{"a[0]"}},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := tc.Cmp.Cmp(tc.B)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(err, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			} else if err != nil {
+				fmt.Printf("have err %v want ComparisonError\n", err)
+				t.Fatal()
+			}
+			if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-NOTEXISTS
+
+func TestSliceNotexists(t *testing.T) {
+	cases := []struct {
+		A       []interface{}
+		B       []interface{}
+		WantErr error
+	}{
+		{[]interface{}{NotExists("a")}, []interface{}{"a"}, &ComparisonError{}},
+		{[]interface{}{NotExists("b")}, []interface{}{"a"}, nil},
+		// Path to a generic object
+		{[]interface{}{NotExists("a", "b")}, []interface{}{map[string]string{"a": "b"}}, &ComparisonError{}},
+		{[]interface{}{NotExists("a", "b")}, []interface{}{map[string]string{"a": "c"}}, nil},
+		{[]interface{}{NotExists("a")}, []interface{}{map[string]string{"a": "c"}}, &ComparisonError{}},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := Cmps(tc.A...)
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-SIZEIS
+
+func TestSliceSizeis(t *testing.T) {
+	cases := []struct {
+		A       []interface{}
+		B       []interface{}
+		WantErr error
+	}{
+		{[]interface{}{SizeIs(1), "a"}, []interface{}{"a"}, nil},
+		{[]interface{}{SizeIs(2), "a"}, []interface{}{"a"}, cmpErr},
+		{[]interface{}{SizeIs(2), "a", "b"}, []interface{}{"a", "b"}, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c := Cmps(tc.A...)
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SLICE-QUANTIFIERS
+
+func TestSliceQuantifiers(t *testing.T) {
+	active := Cmp(F("status", "active"))
+	b := []interface{}{
+		F("status", "active", "role", "admin"),
+		F("status", "idle", "role", "user"),
+		F("status", "active", "role", "admin"),
+	}
+	cases := []struct {
+		A         []interface{}
+		WantErr   error
+		WantPaths []string
+		WantMsg   string
+	}{
+		{[]interface{}{Each(Cmp(F("role", NotEmpty())))}, nil, nil, ""},
+		{[]interface{}{Each(active)}, cmpErr, []string{"[1].status"}, `[1].status: have "idle" want "active"`},
+		{[]interface{}{Each(Cmp(F("status", "x", "role", "x"), AllErrors())), AllErrors()}, cmpErr, []string{"[0].role", "[0].status", "[1].role", "[1].status", "[2].role", "[2].status"}, ""},
+		{[]interface{}{None(Cmp(F("role", "guest")))}, nil, nil, ""},
+		{[]interface{}{None(Cmp(F("role", "admin"))), AllErrors()}, cmpErr, []string{"[0]", "[2]"}, ""},
+		{[]interface{}{AtLeast(2, Cmp(F("role", "admin")))}, nil, nil, ""},
+		{[]interface{}{AtLeast(3, active)}, cmpErr, []string{""}, "have 2 matching want at least 3, unmatched [1]"},
+		{[]interface{}{AtMost(2, active)}, nil, nil, ""},
+		{[]interface{}{AtMost(1, active)}, cmpErr, []string{""}, "have 2 matching want at most 1, matched [0], [2]"},
+		{[]interface{}{Exactly(1, Cmp(F("role", "user")))}, nil, nil, ""},
+		{[]interface{}{Exactly(1, active)}, cmpErr, []string{""}, "have 2 matching want exactly 1, matched [0], [2]"},
+		{[]interface{}{Exactly(0, active)}, cmpErr, []string{""}, ""},
+		// Quantifiers combine with the regular comparison.
+		{[]interface{}{Each(Cmp(F("role", NotEmpty()))), F("status", "active")}, nil, nil, ""},
+		{[]interface{}{Each(At("$.missing", Cmp(1)))}, evalErr, nil, ""},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			// Run through the factory so the funcs are serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: Cmps(tc.A...)}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(b)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			}
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			} else if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			} else if tc.WantMsg != "" && haveErr.Error() != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", haveErr.Error(), tc.WantMsg)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-SINGLE-CMPER-FACTORY
+
+func TestSingleCmperFactory(t *testing.T) {
+	cases := []struct {
+		Req     singleCmp
+		WantErr error
+	}{
+		{singleCmp{}, nil},
+		{singleCmp{A: "a"}, nil},
+		{singleCmp{A: BT{A: "a", B: "b"}}, nil},
+		{singleCmp{A: []string{"a", "b"}}, nil},
+		{singleCmp{A: []interface{}{"a", "b"}}, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			input := CmperFactory{Cmper: tc.Req}
+			output := CmperFactory{}
+			err := toFromJson(input, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmper.Cmp(tc.Req.A)
+			outputKey := ""
+			if s, ok := output.Cmper.(serializer); ok {
+				outputKey = s.SerializeKey()
+			}
+			if tc.Req.SerializeKey() != outputKey {
+				fmt.Printf("wrong key have %v want %v\n", outputKey, tc.Req.SerializeKey())
+				t.Fatal()
+			} else if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-REGISTER
+
+func TestRegister(t *testing.T) {
+	cases := []struct {
+		Cmper   Cmper
+		B       interface{}
+		WantErr error
+	}{
+		{Cmps(Key("a"), NotExists("b"), SizeIs(1), AT{A: "a"}), []interface{}{AT{A: "a"}}, nil},
+		{Cmps(Key("a"), NotExists("b"), SizeIs(1), AT{A: "a"}), []interface{}{BT{A: "a", B: "b"}}, cmpErr},
+		{Cmps(&lengthIsFn{Length: 2}), []interface{}{"ab", "bc"}, nil},
+		{Cmps(&lengthIsFn{Length: 2}), []interface{}{"abc"}, cmpErr},
+		{Cmp(F("a", lengthIsMatcher{Length: 2})), F("a", "ab"), nil},
+		{Cmp(F("a", lengthIsMatcher{Length: 2})), F("a", "abc"), cmpErr},
+		// Matchers without a MarshalJSON() get the marker added.
+		{Cmp(F("a", plainLengthIsMatcher{Length: 2})), F("a", "ab"), nil},
+		{Cmp(F("a", plainLengthIsMatcher{Length: 2})), F("a", "abc"), cmpErr},
+		{Cmps(plainLengthIsMatcher{Length: 2}), []interface{}{"abc"}, cmpErr},
+		{CmpNil(), nil, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			input := CmperFactory{Cmper: tc.Cmper}
+			output := CmperFactory{}
+			err := toFromJson(input, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestRegisterUnknown(t *testing.T) {
+	cases := []struct {
+		Data string
+	}{
+		{`{"key":"unknown"}`},
+		{`{"key":"jacl-slicecmp","cmper":{"fn":[{"key":"unknown"}]}}`},
+		{`{"key":"jacl-notexists"}`},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			f := CmperFactory{}
+			err := json.Unmarshal([]byte(tc.Data), &f)
+			if err == nil {
+				fmt.Printf("have nil err, want error\n")
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-LOAD-FILE
+
+func TestLoadFile(t *testing.T) {
+	cases := []struct {
+		File    string
+		B       interface{}
+		WantErr error
+	}{
+		{"expect_user.json", F("id", "u_1", "name", "Ada", "age", 36, "roles", []string{"dev", "admin"}), nil},
+		{"expect_user.json", F("id", "x_1", "name", "Ada", "age", 36, "roles", []string{"dev", "admin"}), cmpErr},
+		{"expect_user.json", F("id", "u_1", "name", "Ada", "age", 12, "roles", []string{"dev", "admin"}), cmpErr},
+		{"expect_users.yaml", []interface{}{F("id", "u_2", "name", "Grace"), F("id", "u_1", "name", "Ada")}, nil},
+		{"expect_users.yaml", []interface{}{F("id", "u_2", "name", "Alan"), F("id", "u_1", "name", "Ada")}, cmpErr},
+		{"expect_users.yaml", []interface{}{F("id", "u_2", "name", "Grace"), F("id", "u_1", "name", "Ada", "password", "x")}, cmpErr},
+		{"expect_users.yaml", []interface{}{F("id", "u_2", "name", "Grace", "owner", F("secret", "x")), F("id", "u_1", "name", "Ada")}, cmpErr},
+		{"expect_users.yaml", []interface{}{F("id", "u_1", "name", "Ada")}, cmpErr},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			c, err := LoadFile(filepath.Join("testdata", tc.File))
+			if err != nil {
+				panic(err)
+			}
+			haveErr := c.Cmp(tc.B)
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		Data     string
+		WantLine int
+		WantMsg  string
+	}{
+		{`{"cmp": "a", "cmps": ["a"]}`, 1, "1:1: want exactly one of cmp, cmps or nil"},
+		{"{\n\"cmps\": [],\n\"sizes\": 1\n}", 3, "3:1: sizes: unknown field"},
+		{"{\n\"cmp\": {\n\"a\": [1, {\"$jacl\": \"nope\"}]\n}\n}", 3, "3:10: cmp.a[1]: jacl: unknown key nope"},
+		{"cmp:\n  a: {$jacl: regex, pattern: [1]}", 2, "2:6: cmp.a: json: cannot unmarshal array into Go struct field glue.pattern of type string"},
+		{"cmp:\n  a: {$jacl: regex, pattern: \"(\"}", 2, "2:6: cmp.a: pattern: error parsing regexp: missing closing ): `(`"},
+		{"cmp:\n  - a\n  - {$jacl: typeis, type: nope}", 3, "3:5: cmp[1]: type: unknown type nope"},
+		{"cmps: []\nsizeIs: two", 2, "2:9: sizeIs: want integer"},
+		{"cmp: a\nkey: [id]", 1, "1:1: cmp: key requires cmps"},
+		{"cmps: []\nnotExists: [[a, {x: 1}], [b]]", 2, "2:17: notExists[0]: want string"},
+		{`{"cmp": `, 0, "yaml: line 1: did not find expected node content"},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, err := Load([]byte(tc.Data))
+			var le *LoadError
+			if !errors.As(err, &le) {
+				fmt.Printf("have err %v want LoadError\n", err)
+				t.Fatal()
+			} else if le.Line != tc.WantLine {
+				fmt.Printf("have line %v want %v\n", le.Line, tc.WantLine)
+				t.Fatal()
+			} else if le.Error() != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", le.Error(), tc.WantMsg)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-HTTP
+
+func TestHTTP(t *testing.T) {
+	cases := []struct {
+		Cmp         Cmper
+		ContentType string
+		Status      int
+		Body        string
+		WantErr     error
+		WantPaths   []string
+	}{
+		{HTTP(200, nil, nil), "", 200, "", nil, nil},
+		{HTTP(200, nil, nil), "", 404, "", cmpErr, []string{"status"}},
+		{HTTP(0, F("Content-Type", Prefix("application/json")), nil), "application/json; charset=utf-8", 200, "", nil, nil},
+		{HTTP(0, F("Content-Type", "text/plain"), nil), "application/json", 200, "", cmpErr, []string{"header.Content-Type"}},
+		{HTTP(0, F("X-Missing", "a"), nil), "", 200, "", cmpErr, []string{"header.X-Missing"}},
+		{HTTP(200, nil, Cmp(F("a", "a"))), "application/json", 200, `{"a": "a", "b": 1}`, nil, nil},
+		{HTTP(200, nil, Cmp(F("a", "a"))), "application/problem+json", 200, `{"a": "a"}`, nil, nil},
+		{HTTP(200, nil, Cmps(F("a", "a"))), "application/json", 200, `[{"a": "b"}]`, cmpErr, []string{"body[0].a"}},
+		{HTTP(201, nil, Cmp(F("a", "a"))), "application/json", 200, `{"a": "b"}`, cmpErr, []string{"status", "body.a"}},
+		{HTTP(0, nil, Cmp(F("a", "a", "b", []string{"1", "2"}))), "application/x-www-form-urlencoded", 200, `a=a&b=1&b=2`, nil, nil},
+		{HTTP(0, nil, Cmp("hello")), "text/plain", 200, `hello`, nil, nil},
+		{HTTP(0, nil, Cmp(F("a", "a"))), "", 200, `{"a": "a"}`, nil, nil},
+		{HTTP(0, nil, Cmp(F("a", "a"))), "application/json", 200, `{"a": `, evalErr, nil},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if tc.ContentType != "" {
+				rec.Header().Set("Content-Type", tc.ContentType)
+			}
+			rec.WriteHeader(tc.Status)
+			rec.WriteString(tc.Body)
+
+			// Run through the factory so the HTTP cmper is serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: tc.Cmp}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(rec)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			}
+			if !equalErr(haveErr, tc.WantErr) {
+				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+				t.Fatal()
+			} else if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+func TestHTTPHeaders(t *testing.T) {
 	cases := []struct {
-		B       interface{}
+		Headers Fields
+		Have    http.Header
 		WantErr error
 	}{
-		{nil, nil},
-		{"a", cmpErr},
+		{F("Content-Length", 12), http.Header{"Content-Length": {"12"}}, nil},
+		{F("Content-Length", 12), http.Header{"Content-Length": {"13"}}, cmpErr},
+		{F("Content-Length", 12), http.Header{"Content-Length": {"Inf"}}, cmpErr},
+		{F("X-Flag", true), http.Header{"X-Flag": {"true"}}, nil},
+		{F("Vary", "Accept"), http.Header{"Vary": {"Origin", "Accept"}}, nil},
+		{F("Vary", "Cookie"), http.Header{"Vary": {"Origin", "Accept"}}, cmpErr},
+		{F("Vary", Prefix("Acc")), http.Header{"Vary": {"Origin", "Accept"}}, nil},
+		{F("Vary", []string{"Origin", "Accept"}), http.Header{"Vary": {"Origin", "Accept"}}, nil},
+		{F("Vary", []string{"Accept", "Origin"}), http.Header{"Vary": {"Origin", "Accept"}}, cmpErr},
+		{F("X-Ids", []int{1, 2}), http.Header{"X-Ids": {"1", "2"}}, nil},
+		{F("Vary", []string{"Origin"}), http.Header{"Vary": {"Origin", "Accept"}}, cmpErr},
+		{F("X-Debug", IsMissing()), http.Header{}, nil},
+		{F("X-Debug", IsMissing()), http.Header{"X-Debug": {"1"}}, cmpErr},
+		{F("X-Debug", IsNullOrMissing()), http.Header{}, nil},
+		{F("X-Debug", "1"), http.Header{}, cmpErr},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := CmpNil()
-			haveErr := c.Cmp(tc.B)
+			rec := httptest.NewRecorder()
+			for k, v := range tc.Have {
+				rec.Header()[k] = v
+			}
+			rec.WriteHeader(200)
+
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: HTTP(0, tc.Headers, nil)}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(rec)
 			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
@@ -57,126 +1231,322 @@ func TestNilCmp(t *testing.T) {
 }
 
 // ------------------------------------------------------------
-// TEST-SINGLE-CMP
+// TEST-AT
 
-func TestSingleCmp(t *testing.T) {
+func TestAt(t *testing.T) {
+	doc := JSON([]byte(`{"data": {"items": [{"id": 1, "n": "a"}, {"id": 2, "n": "b"}], "a.b": "x"}, "count": 2}`))
 	cases := []struct {
-		A       interface{}
-		B       interface{}
-		WantErr error
+		Cmp       Cmper
+		B         interface{}
+		WantErr   error
+		WantPaths []string
 	}{
-		{"a", "a", nil},
-		{"a", "b", cmpErr},
-		{AT{A: "a"}, AT{A: "a"}, nil},
-		{AT{A: "a"}, AT{A: "b"}, cmpErr},
-		{AT{A: "a"}, BT{A: "a"}, nil},
-		{AT{A: "a"}, BT{A: "a", B: "b"}, nil},
+		{At("$.count", Cmp(2)), doc, nil, nil},
+		{At("/count", Cmp(2)), doc, nil, nil},
+		{At("", Cmp(F("count", 2))), doc, nil, nil},
+		{At("$", Cmp(F("count", 2))), doc, nil, nil},
+		{At("$.data.items[1]", Cmp(F("n", "b"))), doc, nil, nil},
+		{At("$.data.items[-1]", Cmp(F("n", "b"))), doc, nil, nil},
+		{At("/data/items/1", Cmp(F("n", "b"))), doc, nil, nil},
+		{At("$['data']['a.b']", Cmp("x")), doc, nil, nil},
+		{At("$.data.items[*]", Cmps(F("id", 1), F("id", 2))), doc, nil, nil},
+		{At("$.data.items[*].n", Cmps("a", "b")), doc, nil, nil},
+		{At("$.data.items[*].n", Cmps("a", "a", "a")), doc, cmpErr, []string{"data.items[*].n"}},
+		{At("$.data.items[1]", Cmp(F("n", "c"))), doc, cmpErr, []string{"data.items[1].n"}},
+		{At("$.data.items[*]", Cmps(F("id", 1), F("id", 3))), doc, cmpErr, []string{"data.items[1].id"}},
+		{At("$.data.items[*]", Cmps(Key("id"), AllErrors(), F("id", 2, "n", "c"))), doc, cmpErr, []string{"data.items[1].n"}},
+		{At("$.data.items[*].n", Cmps("a", "c")), doc, cmpErr, []string{"data.items[1].n"}},
+		{At("$.data.items[*].id", Cmps(Unordered(), 2, 1)), doc, nil, nil},
+		{At("$.data.items[*]", Cmps(AllErrors(), F("n", "x"), F("n", "y"))), doc, cmpErr, []string{"data.items[0].n", "data.items[1].n"}},
+		{At("$['data']['a.b']", Cmp("y")), doc, cmpErr, []string{`data["a.b"]`}},
+		{At("$.missing", Cmp(1)), doc, evalErr, nil},
+		{At("$.data.items[2]", Cmp(1)), doc, evalErr, nil},
+		{At("/data/items/x", Cmp(1)), doc, evalErr, nil},
+		{At("$.count[*]", Cmps(1)), doc, evalErr, nil},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := Cmp(tc.A)
-			haveErr := c.Cmp(tc.B)
+			// Run through the factory so the at cmper is serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: tc.Cmp}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				for _, m := range ce.Mismatches() {
+					havePaths = append(havePaths, m.Path())
+				}
+			}
 			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
+			} else if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
 			}
 		})
 	}
 }
 
+func TestAtInvalid(t *testing.T) {
+	for i, path := range []string{"data", "$..a", "$.", "$[", "$[x]", "$.a b["} {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					fmt.Printf("have no panic for %v\n", path)
+					t.Fatal()
+				}
+			}()
+			At(path, nil)
+		})
+	}
+}
+
 // ------------------------------------------------------------
-// TEST-SLICE-CMP
+// TEST-SCHEMA
 
-func TestSliceCmp(t *testing.T) {
+func TestSchema(t *testing.T) {
+	user := `{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"name": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[a-z]+$"},
+			"role": {"enum": ["admin", "user"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+			"a/b": {"const": true}
+		},
+		"additionalProperties": false
+	}`
 	cases := []struct {
-		A       []interface{}
-		B       []interface{}
-		WantErr error
+		Schema    string
+		B         interface{}
+		WantErr   error
+		WantPaths []string
+		WantMsg   string
 	}{
-		{[]interface{}{"a"}, []interface{}{"a"}, nil},
-		{[]interface{}{"a", "b"}, []interface{}{"a", "b"}, nil},
-		{[]interface{}{"a"}, []interface{}{"b"}, cmpErr},
-		{[]interface{}{AT{A: "a"}}, []interface{}{AT{A: "a"}}, nil},
-		{[]interface{}{AT{A: "a"}}, []interface{}{AT{A: "b"}}, cmpErr},
-		{[]interface{}{AT{A: "a"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
-		{[]interface{}{BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "c"}}, cmpErr},
+		{user, F("id", 1, "name", "ann", "role", "user", "tags", []string{"a"}), nil, nil, ""},
+		{user, BT{A: "a"}, cmpErr, []string{"/id", "/name", "/a"}, ""},
+		{user, F("id", 1.5, "name", "Ann"), cmpErr, []string{"/id", "/name"}, "2 mismatches:\n\t/id: have 1.5, want type integer\n\t/name: have \"Ann\", want match for ^[a-z]+$"},
+		{user, F("id", 0, "name", "annabelle"), cmpErr, []string{"/id", "/name"}, "2 mismatches:\n\t/id: have 0, want minimum 1\n\t/name: have \"annabelle\", want maxLength 8"},
+		{user, F("id", 2.0, "name", "ann", "role", "guest"), cmpErr, []string{"/role"}, `/role: have "guest", want one of ["admin","user"]`},
+		{user, F("id", 2, "name", "ann", "tags", []interface{}{"a", 1, "c"}), cmpErr, []string{"/tags", "/tags/1"}, ""},
+		{user, F("id", 2, "name", "ann", "a/b", false), cmpErr, []string{"/a~1b"}, ""},
+		{user, F("name", "ann"), cmpErr, []string{"/id"}, "/id: missing, required by schema"},
+		{user, F("id", 2, "name", "ann", "x", 1), cmpErr, []string{"/x"}, "/x: have 1, want no additional properties"},
+		{user, []interface{}{}, cmpErr, []string{""}, "have [], want type object"},
+		// Numbers, types and boolean schemas.
+		{`{"type": ["number", "null"], "exclusiveMinimum": 0, "exclusiveMaximum": 1}`, 0.5, nil, nil, ""},
+		{`{"type": ["number", "null"], "exclusiveMinimum": 0, "exclusiveMaximum": 1}`, nil, nil, nil, ""},
+		{`{"type": ["number", "null"], "exclusiveMinimum": 0, "exclusiveMaximum": 1}`, 1, cmpErr, []string{""}, "have 1, want exclusiveMaximum 1"},
+		{`{"type": ["number", "null"]}`, "1", cmpErr, []string{""}, `have "1", want type null or number`},
+		// Integer limits are exact, beyond float64 precision.
+		{`{"exclusiveMaximum": 9007199254740993}`, json.Number("9007199254740992"), nil, nil, ""},
+		{`{"minimum": 9007199254740993}`, json.Number("9007199254740992"), cmpErr, []string{""}, "have 9007199254740992, want minimum 9007199254740993"},
+		{`{"maximum": 1.5}`, json.Number("1.25"), nil, nil, ""},
+		{`{"maximum": 1.5}`, json.Number("15e-1"), nil, nil, ""},
+		{`{"maximum": 1.5}`, json.Number("1.50000000000000000001"), cmpErr, []string{""}, ""},
+		{`{"items": {"type": "boolean"}, "minItems": 2}`, []bool{true}, cmpErr, []string{""}, "have [true], want minItems 2"},
+		{`{"additionalProperties": {"type": "string"}}`, F("a", "x", "b", 1), cmpErr, []string{"/b"}, ""},
+		{`true`, F("a", 1), nil, nil, ""},
+		{`false`, F("a", 1), cmpErr, []string{""}, `have {"a":1}, want nothing, the schema is false`},
+		// Unsupported keywords are ignored.
+		{`{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "t", "format": "email"}`, "x", nil, nil, ""},
+		// Values that can't be normalized can't be validated.
+		{`true`, func() {}, evalErr, nil, ""},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := Cmps(tc.A...)
-			haveErr := c.Cmp(tc.B)
+			// Run through the factory so the schema is serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: Schema([]byte(tc.Schema))}, &output)
+			if err != nil {
+				panic(err)
+			}
+			// The schema is compiled as it is unmarshalled.
+			if sc, ok := output.Cmper.(*schemaCmp); !ok || sc.root == nil {
+				fmt.Printf("have %T want a compiled *schemaCmp\n", output.Cmper)
+				t.Fatal()
+			}
+			haveErr := output.Cmp(tc.B)
 			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
+			} else if tc.WantMsg != "" && haveErr.Error() != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", haveErr.Error(), tc.WantMsg)
+				t.Fatal()
+			}
+			var havePaths []string
+			var ce *ComparisonError
+			if errors.As(haveErr, &ce) {
+				for _, m := range ce.Mismatches() {
+					if m.Reason() != ReasonSchema {
+						fmt.Printf("have reason %v want %v\n", m.Reason(), ReasonSchema)
+						t.Fatal()
+					}
+					havePaths = append(havePaths, m.Path())
+				}
+			}
+			if toJson(havePaths) != toJson(tc.WantPaths) {
+				fmt.Printf("have paths %v want %v\n", havePaths, tc.WantPaths)
+				t.Fatal()
 			}
 		})
 	}
 }
 
+func TestSchemaInvalid(t *testing.T) {
+	for i, schema := range []string{``, `{`, `1`, `{"type": "int"}`, `{"minimum": "1"}`, `{"minLength": -1}`, `{"pattern": "("}`, `{"properties": {"a": {"required": "a"}}}`, `{"items": [true]}`} {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					fmt.Printf("have no panic for %v\n", schema)
+					t.Fatal()
+				}
+			}()
+			Schema([]byte(schema))
+		})
+	}
+}
+
 // ------------------------------------------------------------
-// TEST-SLICE-KEY
+// TEST-COMBINATORS
 
-func TestSliceKey(t *testing.T) {
+func TestCombinators(t *testing.T) {
+	b := BT{A: "a", B: "b"}
 	cases := []struct {
-		A       []interface{}
-		B       []interface{}
+		Cmp     Cmper
+		B       interface{}
 		WantErr error
+		WantMsg string
 	}{
-		{[]interface{}{Key("a"), AT{A: "a"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
-		{[]interface{}{Key("a"), AT{A: "a"}}, []interface{}{AT{A: "-"}, BT{A: "a", B: "b"}}, nil},
-		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "b"}}, nil},
-		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "c"}}, cmpErr},
-		// Everything in A must be in B, even with keys. This is testing unordered comparisons.
-		{[]interface{}{Key("a", "b"), BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, []interface{}{BT{A: "a", B: "b"}}, cmpErr},
-		// But B can have more than A. This is testing unordered comparisons.
-		{[]interface{}{Key("a", "b"), BT{A: "a", B: "b"}}, []interface{}{BT{A: "d", B: "e"}, BT{A: "a", B: "b"}}, nil},
+		{All(Cmp(F("a", "a")), Cmp(F("b", "b"))), b, nil, ""},
+		{All(Cmp(F("a", "a")), Cmp(F("b", "c"))), b, cmpErr, "1 of 2 branches failed:\n\t[1] b: have \"b\" want \"c\""},
+		{All(Cmp(F("a", "x")), Cmp(F("b", "c"), AllErrors())), b, cmpErr, "2 of 2 branches failed:\n\t[0] a: have \"a\" want \"x\"\n\t[1] b: have \"b\" want \"c\""},
+		{All(Cmp(F("a", "a")), At("$.c", Cmp(1))), b, evalErr, ""},
+		{AnyOf(Cmp(F("a", "x")), Cmp(F("b", "b"))), b, nil, ""},
+		{AnyOf(At("$.c", Cmp(1)), Cmp(F("b", "b"))), b, nil, ""},
+		{AnyOf(Cmp(F("a", "x")), Cmp(F("a", "y"))), b, cmpErr, "none of 2 branches matched:\n\t[0] a: have \"a\" want \"x\"\n\t[1] a: have \"a\" want \"y\""},
+		{Not(Cmp(F("a", "x"))), b, nil, ""},
+		{Not(Cmp(F("a", "a"))), b, cmpErr, "matched, want no match"},
+		{Not(At("$.c", Cmp(1))), b, evalErr, ""},
+		{Not(Not(Cmp(F("a", "a")))), b, nil, ""},
+		// Branches nest.
+		{AnyOf(All(Cmp(F("a", "x")), Cmp(F("b", "b"))), Not(Cmp(F("a", "a")))), b, cmpErr, "none of 2 branches matched:\n\t[0] 1 of 2 branches failed:\n\t\t[0] a: have \"a\" want \"x\"\n\t[1] matched, want no match"},
+		// Paths are prefixed in every branch.
+		{At("$.a", AnyOf(Cmp("x"), Cmp("y"))), F("a", "a"), cmpErr, "a: none of 2 branches matched:\n\t[0] a: have \"a\" want \"x\"\n\t[1] a: have \"a\" want \"y\""},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := Cmps(tc.A...)
-			haveErr := c.Cmp(tc.B)
+			// Run through the factory so the combinators are serializable.
+			output := CmperFactory{}
+			err := toFromJson(CmperFactory{Cmper: tc.Cmp}, &output)
+			if err != nil {
+				panic(err)
+			}
+			haveErr := output.Cmp(tc.B)
 			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
+			} else if tc.WantMsg != "" && haveErr.Error() != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", haveErr.Error(), tc.WantMsg)
+				t.Fatal()
 			}
 		})
 	}
 }
 
 // ------------------------------------------------------------
-// TEST-SLICE-NOTEXISTS
+// TEST-VARS
 
-func TestSliceNotexists(t *testing.T) {
-	cases := []struct {
-		A       []interface{}
-		B       []interface{}
+func TestVars(t *testing.T) {
+	type step struct {
+		// Cmp answers the comparison, using the Vars.
+		Cmp     func(*Vars) Cmper
+		B       interface{}
 		WantErr error
+		WantMsg string
+	}
+	capture := func(vars *Vars) Cmper { return Cmp(F("id", Capture("id"), "name", "a"), vars) }
+	items := []interface{}{F("id", "x1", "name", "b"), F("id", "x2", "name", "a")}
+	cases := []struct {
+		Steps    []step
+		WantVars map[string]interface{}
 	}{
-		{[]interface{}{NotExists("a")}, []interface{}{"a"}, &ComparisonError{}},
-		{[]interface{}{NotExists("b")}, []interface{}{"a"}, nil},
-		// Path to a generic object
-		{[]interface{}{NotExists("a", "b")}, []interface{}{map[string]string{"a": "b"}}, &ComparisonError{}},
-		{[]interface{}{NotExists("a", "b")}, []interface{}{map[string]string{"a": "c"}}, nil},
-		{[]interface{}{NotExists("a")}, []interface{}{map[string]string{"a": "c"}}, &ComparisonError{}},
+		{[]step{{capture, F("id", "x2", "name", "a"), nil, ""}}, map[string]interface{}{"id": "x2"}},
+		// Captures are only stored when the comparison passes.
+		{[]step{{capture, F("id", "x2", "name", "b"), cmpErr, ""}}, map[string]interface{}{}},
+		{[]step{{capture, F("name", "a"), cmpErr, "id: missing, want {\"$jacl\":\"jacl-capture\",\"name\":\"id\"}"}}, map[string]interface{}{}},
+		// Refs require equality.
+		{[]step{
+			{capture, F("id", "x2", "name", "a"), nil, ""},
+			{func(vars *Vars) Cmper { return Cmp(F("id", Ref("id")), vars) }, F("id", "x2"), nil, ""},
+			{func(vars *Vars) Cmper { return Cmp(F("id", Ref("id")), vars) }, F("id", "x1"), cmpErr, `id: have "x1", want id = "x2"`},
+		}, map[string]interface{}{"id": "x2"}},
+		{[]step{
+			{func(vars *Vars) Cmper { return Cmp(F("a", Capture("a")), vars) }, F("a", F("b", 1)), nil, ""},
+			{func(vars *Vars) Cmper { return Cmp(F("a", Ref("a")), vars) }, F("a", F("b", 1, "c", 2)), cmpErr, ""},
+			{func(vars *Vars) Cmper { return Cmp(F("a", Ref("a")), vars) }, F("a", F("b", 1.0)), nil, ""},
+		}, map[string]interface{}{"a": F("b", 1)}},
+		// Refs can see values captured earlier in the same comparison.
+		{[]step{{func(vars *Vars) Cmper { return Cmp(F("a", Capture("v"), "b", Ref("v")), vars) }, F("a", 1, "b", 1), nil, ""}}, map[string]interface{}{"v": 1}},
+		{[]step{{func(vars *Vars) Cmper { return Cmp(F("a", Capture("v"), "b", Ref("v")), vars) }, F("a", 1, "b", 2), cmpErr, "b: have 2, want v = 1"}}, map[string]interface{}{}},
+		// Refs in keys find the captured item, in any position.
+		{[]step{
+			{capture, F("id", "x2", "name", "a"), nil, ""},
+			{func(vars *Vars) Cmper { return Cmps(Key("id"), F("id", Ref("id"), "name", "a"), vars) }, items, nil, ""},
+			{func(vars *Vars) Cmper { return Cmps(Key("id"), F("id", Ref("id"), "name", "b"), vars) }, items, cmpErr, `[1].name: have "a" want "b"`},
+		}, map[string]interface{}{"id": "x2"}},
+		// Captures in Cmps, including unordered slices.
+		{[]step{{func(vars *Vars) Cmper { return Cmps(F("id", Capture("first")), F("id", Capture("second")), vars) }, items, nil, ""}}, map[string]interface{}{"first": "x1", "second": "x2"}},
+		{[]step{{func(vars *Vars) Cmper {
+			return Cmps(F("name", "a", "id", Capture("a")), Unordered(), vars)
+		}, items, nil, ""}}, map[string]interface{}{"a": "x2"}},
+		// Combinators only keep captures from branches that decide the result.
+		{[]step{{func(vars *Vars) Cmper { return Not(Cmp(F("id", Capture("id")), vars)) }, F("id", "x1"), cmpErr, ""}}, map[string]interface{}{}},
+		{[]step{{func(vars *Vars) Cmper {
+			return AnyOf(Cmp(F("id", Capture("a"), "n", "x"), vars), Cmp(F("id", Capture("b")), vars), Cmp(F("id", Capture("c")), vars))
+		}, F("id", "x1", "n", "y"), nil, ""}}, map[string]interface{}{"b": "x1"}},
+		{[]step{{func(vars *Vars) Cmper { return All(Cmp(F("id", Capture("a")), vars), Cmp(F("n", "x"))) }, F("id", "x1", "n", "y"), cmpErr, ""}}, map[string]interface{}{}},
+		{[]step{{func(vars *Vars) Cmper { return At("/data", Cmp(F("id", Capture("a")), vars)) }, F("data", F("id", "x1")), nil, ""}}, map[string]interface{}{"a": "x1"}},
+		// Without Vars, or without a capture, refs fail.
+		{[]step{{func(vars *Vars) Cmper { return Cmp(F("id", Ref("id"))) }, F("id", "x1"), cmpErr, `id: have "x1", ref id requires Vars`}}, map[string]interface{}{}},
+		{[]step{{func(vars *Vars) Cmper { return Cmp(F("id", Ref("id")), vars) }, F("id", "x1"), cmpErr, `id: have "x1", nothing captured for id`}}, map[string]interface{}{}},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := Cmps(tc.A...)
-			haveErr := c.Cmp(tc.B)
-			if !equalErr(haveErr, tc.WantErr) {
-				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
+			vars := NewVars()
+			for j, st := range tc.Steps {
+				haveErr := st.Cmp(vars).Cmp(st.B)
+				if !equalErr(haveErr, st.WantErr) {
+					fmt.Printf("step %v have err %v want %v\n", j, haveErr, st.WantErr)
+					t.Fatal()
+				} else if st.WantMsg != "" && haveErr.Error() != st.WantMsg {
+					fmt.Printf("step %v have msg %v want %v\n", j, haveErr.Error(), st.WantMsg)
+					t.Fatal()
+				}
+			}
+			haveVars := make(map[string]interface{})
+			for _, name := range vars.Names() {
+				haveVars[name], _ = vars.Get(name)
+			}
+			if toJson(haveVars) != toJson(tc.WantVars) {
+				fmt.Printf("have vars %v want %v\n", toJson(haveVars), toJson(tc.WantVars))
 				t.Fatal()
 			}
 		})
@@ -184,74 +1554,255 @@ func TestSliceNotexists(t *testing.T) {
 }
 
 // ------------------------------------------------------------
-// TEST-SLICE-SIZEIS
+// TEST-EVENTUALLY
 
-func TestSliceSizeis(t *testing.T) {
+func TestEventually(t *testing.T) {
+	type fetchFn = func(context.Context) (interface{}, error)
+	ms := time.Millisecond
+	eventually := func(timeout time.Duration) func(fetchFn, Cmper) error {
+		return func(fetch fetchFn, cmp Cmper) error {
+			return Eventually(func() (interface{}, error) { return fetch(context.Background()) }, cmp, timeout, ms)
+		}
+	}
+	eventuallyCtx := func(timeout time.Duration) func(fetchFn, Cmper) error {
+		return func(fetch fetchFn, cmp Cmper) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return EventuallyContext(ctx, fetch, cmp, ms)
+		}
+	}
+	consistently := func(duration time.Duration) func(fetchFn, Cmper) error {
+		return func(fetch fetchFn, cmp Cmper) error {
+			return Consistently(func() (interface{}, error) { return fetch(context.Background()) }, cmp, duration, ms)
+		}
+	}
+	consistentlyCtx := func(duration time.Duration) func(fetchFn, Cmper) error {
+		return func(fetch fetchFn, cmp Cmper) error {
+			ctx, cancel := context.WithTimeout(context.Background(), duration)
+			defer cancel()
+			return ConsistentlyContext(ctx, fetch, cmp, ms)
+		}
+	}
+	cancelled := func(fetch fetchFn, cmp Cmper) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ConsistentlyContext(ctx, fetch, cmp, ms)
+	}
+	fetchErr := errors.New("unavailable")
+	// hang waits for the context, stall ignores it.
+	hang, stall := errors.New("hang"), errors.New("stall")
 	cases := []struct {
-		A       []interface{}
-		B       []interface{}
-		WantErr error
+		Run func(fetchFn, Cmper) error
+		Cmp Cmper
+		// Each attempt answers the next value, then the last forever.
+		// An error value is answered as a fetch error.
+		Values       []interface{}
+		WantErr      error
+		WantAttempts int // 0 skips the check
 	}{
-		{[]interface{}{SizeIs(1), "a"}, []interface{}{"a"}, nil},
-		{[]interface{}{SizeIs(2), "a"}, []interface{}{"a"}, cmpErr},
-		{[]interface{}{SizeIs(2), "a", "b"}, []interface{}{"a", "b"}, nil},
+		{eventually(time.Second), Cmp(F("status", "done")), []interface{}{F("status", "done")}, nil, 1},
+		{eventually(time.Second), Cmp(F("status", "done")), []interface{}{F("status", "running"), fetchErr, F("status", "done")}, nil, 3},
+		{eventually(20 * ms), Cmp(F("status", "done")), []interface{}{F("status", "running")}, cmpErr, 0},
+		// The last comparison error is kept over later fetch errors.
+		{eventually(20 * ms), Cmp(F("status", "done")), []interface{}{F("status", "running"), fetchErr}, cmpErr, 0},
+		{eventually(20 * ms), Cmp(F("status", "done")), []interface{}{fetchErr}, evalErr, 0},
+		{consistently(20 * ms), Cmp(F("status", "done")), []interface{}{F("status", "done")}, nil, 0},
+		{consistently(time.Second), Cmp(F("status", "done")), []interface{}{F("status", "done"), F("status", "failed")}, cmpErr, 2},
+		{consistently(time.Second), Cmp(F("status", "done")), []interface{}{F("status", "done"), fetchErr}, evalErr, 2},
+		{cancelled, Cmp(F("status", "done")), []interface{}{F("status", "done")}, evalErr, 0},
+		// Fetches that don't answer are abandoned when the context is done.
+		{eventuallyCtx(20 * ms), Cmp(F("status", "done")), []interface{}{F("status", "running"), hang}, cmpErr, 2},
+		{eventuallyCtx(20 * ms), Cmp(F("status", "done")), []interface{}{stall}, evalErr, 1},
+		{eventually(20 * ms), Cmp(F("status", "done")), []interface{}{stall}, evalErr, 1},
+		{consistentlyCtx(20 * ms), Cmp(F("status", "done")), []interface{}{F("status", "done"), hang}, nil, 0},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
+		// Abandoned fetches outlive the case, so they need their own copy.
+		tc := tc
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			c := Cmps(tc.A...)
-			haveErr := c.Cmp(tc.B)
+			var calls int32
+			fetch := func(ctx context.Context) (interface{}, error) {
+				n := int(atomic.AddInt32(&calls, 1))
+				v := tc.Values[len(tc.Values)-1]
+				if n <= len(tc.Values) {
+					v = tc.Values[n-1]
+				}
+				switch v {
+				case hang:
+					<-ctx.Done()
+					return nil, ctx.Err()
+				case stall:
+					time.Sleep(time.Second)
+				}
+				if err, ok := v.(error); ok {
+					return nil, err
+				}
+				return v, nil
+			}
+			start := time.Now()
+			haveErr := tc.Run(fetch, tc.Cmp)
+			haveCalls := int(atomic.LoadInt32(&calls))
 			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
+			} else if elapsed := time.Since(start); elapsed > 500*ms {
+				fmt.Printf("have elapsed %v want under 500ms\n", elapsed)
+				t.Fatal()
+			}
+			if tc.WantErr == nil {
+				return
+			}
+			if tc.WantAttempts > 0 && haveCalls != tc.WantAttempts {
+				fmt.Printf("have attempts %v want %v\n", haveCalls, tc.WantAttempts)
+				t.Fatal()
+			}
+			var ce *ComparisonError
+			// An attempt abandoned at the deadline may not have called fetch yet.
+			if errors.As(haveErr, &ce) && (ce.Attempts() < haveCalls || ce.Attempts() > haveCalls+1 || ce.Elapsed() <= 0) {
+				fmt.Printf("have attempts %v elapsed %v want %v\n", ce.Attempts(), ce.Elapsed(), haveCalls)
+				t.Fatal()
+			}
+			if err, ok := tc.Values[len(tc.Values)-1].(error); ok && err == fetchErr && tc.WantErr == evalErr && !errors.Is(haveErr, err) {
+				fmt.Printf("have err %v want %v\n", haveErr, err)
+				t.Fatal()
 			}
 		})
 	}
 }
 
 // ------------------------------------------------------------
-// TEST-SINGLE-CMPER-FACTORY
+// TEST-GOLDEN
 
-func TestSingleCmperFactory(t *testing.T) {
+func TestGolden(t *testing.T) {
 	cases := []struct {
-		Req     singleCmp
-		WantErr error
+		Golden   string
+		Opts     GoldenOpts
+		B        interface{}
+		WantErr  error
+		WantFile string
 	}{
-		{singleCmp{}, nil},
-		{singleCmp{A: "a"}, nil},
-		{singleCmp{A: BT{A: "a", B: "b"}}, nil},
-		{singleCmp{A: []string{"a", "b"}}, nil},
-		{singleCmp{A: []interface{}{"a", "b"}}, nil},
+		// Missing files are an evaluation error.
+		{"", GoldenOpts{}, F("a", "a"), evalErr, ""},
+		{"", GoldenOpts{Update: true}, F("a", "a"), nil, "{\n\t\"a\": \"a\"\n}\n"},
+		{`{"a": "a"}`, GoldenOpts{}, F("a", "a", "b", "b"), nil, `{"a": "a"}`},
+		{`{"a": "a"}`, GoldenOpts{}, F("a", "b"), cmpErr, `{"a": "a"}`},
+		{`{"a": 0.3}`, GoldenOpts{Options: []interface{}{Tolerance(0.01, 0)}}, F("a", 0.301), nil, `{"a": 0.3}`},
+		{`{"a": "a"}`, GoldenOpts{Update: true}, F("a", "b", "b", "b"), nil, "{\n\t\"a\": \"b\",\n\t\"b\": \"b\"\n}\n"},
+		{`{"a": "a", "c": [{"d": 1}]}`, GoldenOpts{Update: true, Prune: true}, F("a", "b", "b", "b", "c", []interface{}{F("d", 2, "e", 3), F("d", 4, "f", 5)}), nil, "{\n\t\"a\": \"b\",\n\t\"c\": [\n\t\t{\n\t\t\t\"d\": 2\n\t\t},\n\t\t{\n\t\t\t\"d\": 4\n\t\t}\n\t]\n}\n"},
 	}
 	for i, tc := range cases {
 		if !WantTestCase(i) {
 			continue
 		}
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			input := CmperFactory{Cmper: tc.Req}
-			output := CmperFactory{}
-			err := toFromJson(input, &output)
+			dir, err := ioutil.TempDir("", "jacl")
 			if err != nil {
 				panic(err)
 			}
-			haveErr := output.Cmper.Cmp(tc.Req.A)
-			outputKey := ""
-			if s, ok := output.Cmper.(serializer); ok {
-				outputKey = s.SerializeKey()
+			defer os.RemoveAll(dir)
+			fn := filepath.Join(dir, "golden.json")
+			if tc.Golden != "" {
+				err = ioutil.WriteFile(fn, []byte(tc.Golden), 0644)
+				if err != nil {
+					panic(err)
+				}
 			}
-			if tc.Req.SerializeKey() != outputKey {
-				fmt.Printf("wrong key have %v want %v\n", outputKey, tc.Req.SerializeKey())
-				t.Fatal()
-			} else if !equalErr(haveErr, tc.WantErr) {
+			haveErr := GoldenWith(fn, tc.Opts).Cmp(tc.B)
+			haveFile, _ := ioutil.ReadFile(fn)
+			if !equalErr(haveErr, tc.WantErr) {
 				fmt.Printf("have err %v want %v\n", haveErr, tc.WantErr)
 				t.Fatal()
+			} else if string(haveFile) != tc.WantFile {
+				fmt.Printf("have file %v want %v\n", string(haveFile), tc.WantFile)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-ASSERT
+
+func TestAssert(t *testing.T) {
+	// Diffs are colored when stdout is a terminal.
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	cases := []struct {
+		Fn        func(testing.TB)
+		WantOk    bool
+		WantFatal bool
+		WantMsg   string
+	}{
+		{func(t testing.TB) { Assert(t, AT{A: "a"}, BT{A: "a", B: "b"}) }, true, false, ""},
+		{func(t testing.TB) { Assert(t, AT{A: "a"}, AT{A: "b"}) }, false, false, "jacl: comparison failed with 1 mismatch(es):\n\ta: have \"b\" want \"a\"\ndiff (- want, + have):\n  {\n-   \"a\": \"a\"\n+   \"a\": \"b\"\n  }"},
+		{func(t testing.TB) { Require(t, AT{A: "a"}, AT{A: "b"}) }, false, true, ""},
+		{func(t testing.TB) { Assert(t, AT{A: "a"}, AT{A: "b"}, Strict(), AllErrors()) }, false, false, ""},
+		{func(t testing.TB) { Assert(t, CmpNil(), nil) }, true, false, ""},
+		{func(t testing.TB) {
+			Asserts(t, []interface{}{Key("a"), AT{A: "a"}}, []interface{}{AT{A: "b"}, AT{A: "a"}})
+		}, true, false, ""},
+		{func(t testing.TB) { Requires(t, []interface{}{SizeIs(2)}, []interface{}{AT{A: "a"}}) }, false, true, ""},
+		{func(t testing.TB) { Assert(t, AT{A: "a"}, func() {}) }, false, false, "jacl: comparison could not be performed: json: unsupported type: func()"},
+		// Options are applied to a Cmper made by Cmp() or Cmps().
+		{func(t testing.TB) {
+			Assert(t, Cmps(AT{A: "x"}, AT{A: "y"}), []interface{}{AT{A: "a"}, AT{A: "b"}}, AllErrors())
+		}, false, false, "jacl: comparison failed with 2 mismatch(es):\n\t[0].a: have \"a\" want \"x\"\n\t[1].a: have \"b\" want \"y\"\ndiff (- want, + have):\n  [\n    {\n-     \"a\": \"x\"\n+     \"a\": \"a\"\n    },\n    {\n-     \"a\": \"y\"\n+     \"a\": \"b\"\n    }\n  ]"},
+		{func(t testing.TB) { Assert(t, Cmp(AT{A: "a"}), BT{A: "a", B: "b"}, Strict()) }, false, false, ""},
+		{func(t testing.TB) {
+			defer func() {
+				if recover() != nil {
+					t.Errorf("panic")
+				}
+			}()
+			Assert(t, CmpNil(), nil, AllErrors())
+		}, false, false, "panic"},
+	}
+	for i, tc := range cases {
+		if !WantTestCase(i) {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			tb := &fakeTB{TB: t}
+			tc.Fn(tb)
+			if tb.failed == tc.WantOk {
+				fmt.Printf("have failed %v want %v\n", tb.failed, !tc.WantOk)
+				t.Fatal()
+			} else if tb.fatal != tc.WantFatal {
+				fmt.Printf("have fatal %v want %v\n", tb.fatal, tc.WantFatal)
+				t.Fatal()
+			} else if tc.WantMsg != "" && tb.msg != tc.WantMsg {
+				fmt.Printf("have msg %v want %v\n", tb.msg, tc.WantMsg)
+				t.Fatal()
 			}
 		})
 	}
 }
 
+// fakeTB records failures instead of reporting them.
+type fakeTB struct {
+	testing.TB
+	failed bool
+	fatal  bool
+	msg    string
+}
+
+func (t *fakeTB) Helper() {
+}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.failed = true
+	t.msg = fmt.Sprintf(format, args...)
+}
+
+func (t *fakeTB) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+}
+
 // ------------------------------------------------------------
 // TEST-SLICE-CMPER-FACTORY
 
@@ -299,6 +1850,52 @@ func TestSliceCmperFactory(t *testing.T) {
 }
 */
 
+// ------------------------------------------------------------
+// BENCHMARKS
+
+func BenchmarkCmpsLarge(b *testing.B) {
+	a, have := largeSlices(50000)
+	cmp := Cmps(a...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cmp.Cmp(have); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNormalizeLarge(b *testing.B) {
+	_, have := largeSlices(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := normalize(have); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoundTripLarge(b *testing.B) {
+	_, have := largeSlices(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		if err := toFromJson(have, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeSlices() answers n expected items and the matching results.
+func largeSlices(n int) ([]interface{}, []BT) {
+	a := make([]interface{}, 0, n)
+	have := make([]BT, 0, n)
+	for i := 0; i < n; i++ {
+		a = append(a, AT{A: i})
+		have = append(have, BT{A: i, B: fmt.Sprintf("item %v", i)})
+	}
+	return a, have
+}
+
 // ------------------------------------------------------------
 // COMPARISON TYPES
 
@@ -311,9 +1908,138 @@ type BT struct {
 	B interface{} `json:"b,omitempty"`
 }
 
+// ZT has zero values dropped by omitempty.
+type ZT struct {
+	Deleted bool   `json:"deleted,omitempty"`
+	Count   int    `json:"count,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Owner   *AT    `json:"owner,omitempty"`
+}
+
+// RT has a zero value that is required.
+type RT struct {
+	Deleted bool `json:"deleted,omitempty" jacl:"required"`
+}
+
+// NT exercises the json encoding rules.
+type NT struct {
+	Embedded
+	*EmbeddedPtr
+	Name   string  `json:"name"`
+	Skip   string  `json:"-"`
+	Num    int     `json:"num,string"`
+	NumPtr *int    `json:"numPtr,string"`
+	StrPtr *string `json:"strPtr,string"`
+	Empty  *string `json:"empty,omitempty"`
+	NoTag  bool
+	hidden int
+}
+
+type Embedded struct {
+	E    string `json:"e"`
+	Name string `json:"name"`
+}
+
+type EmbeddedPtr struct {
+	P string `json:"p"`
+}
+
+// textKey is a map key with a text encoding.
+type textKey string
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte("key-" + string(k)), nil
+}
+
+// textIntKey is a map key with a text encoding and an int kind.
+type textIntKey int
+
+func (k textIntKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("key-%v", int(k))), nil
+}
+
+// ------------------------------------------------------------
+// CUSTOM TYPES
+
+func init() {
+	Register("test-lengthis", func() interface{} { return &lengthIsFn{} })
+	Register("test-lengthis-matcher", func() interface{} { return &lengthIsMatcher{} })
+	Register("test-plain-lengthis-matcher", func() interface{} { return &plainLengthIsMatcher{} })
+}
+
+// lengthIsFn is a custom cmps func that requires each
+// item to be a string of a given length.
+type lengthIsFn struct {
+	Length int `json:"length"`
+}
+
+func (f lengthIsFn) Eval(resp []interface{}) error {
+	for _, r := range resp {
+		if s, ok := r.(string); !ok || len(s) != f.Length {
+			return newComparisonError("wrong length")
+		}
+	}
+	return nil
+}
+
+func (f lengthIsFn) FactoryKey() string {
+	return "test-lengthis"
+}
+
+// lengthIsMatcher is a custom matcher that requires a
+// string of a given length.
+type lengthIsMatcher struct {
+	Length int `json:"length"`
+}
+
+func (m lengthIsMatcher) Match(v interface{}) error {
+	if s, ok := v.(string); !ok || len(s) != m.Length {
+		return fmt.Errorf("want length %v", m.Length)
+	}
+	return nil
+}
+
+func (m lengthIsMatcher) FactoryKey() string {
+	return "test-lengthis-matcher"
+}
+
+func (m lengthIsMatcher) MarshalJSON() ([]byte, error) {
+	type glue lengthIsMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// plainLengthIsMatcher is lengthIsMatcher without a MarshalJSON().
+type plainLengthIsMatcher struct {
+	Length int `json:"length"`
+}
+
+func (m plainLengthIsMatcher) Match(v interface{}) error {
+	return lengthIsMatcher{Length: m.Length}.Match(v)
+}
+
+func (m plainLengthIsMatcher) FactoryKey() string {
+	return "test-plain-lengthis-matcher"
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+// addFloat() adds at runtime, to avoid exact constant arithmetic.
+func addFloat(a, b float64) float64 {
+	return a + b
+}
+
 // ------------------------------------------------------------
 // CONST and VAR
 
 var (
-	cmpErr = newComparisonError("")
+	cmpErr  = newComparisonError("")
+	evalErr = newEvaluationError(errors.New(""))
 )
@@ -1,7 +1,10 @@
 package jacl
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 )
 
 // ------------------------------------------------------------
@@ -18,7 +21,7 @@ func toFromJson(pairs ...interface{}) error {
 			if err != nil {
 				return err
 			}
-			err = json.Unmarshal(b, p)
+			err = unmarshalJson(b, p)
 			if err != nil {
 				return err
 			}
@@ -30,6 +33,79 @@ func toFromJson(pairs ...interface{}) error {
 	return nil
 }
 
+// ------------------------------------------------------------
+// UNMARSHAL-JSON
+
+// unmarshalJson() is json.Unmarshal, except numbers decoded into
+// generic values are json.Number instead of float64, so integers
+// larger than 2^53 are preserved.
+func unmarshalJson(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err := d.Decode(v)
+	if err != nil {
+		return err
+	}
+	if d.More() {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// JSON-INPUT
+
+// jsonInput is JSON text used as a comparison input. It marshals
+// to itself, so it can be used anywhere a value can.
+type jsonInput struct {
+	data []byte
+	err  error
+}
+
+func (j jsonInput) MarshalJSON() ([]byte, error) {
+	if j.err != nil {
+		return nil, j.err
+	}
+	if !json.Valid(j.data) {
+		var v interface{}
+		err := json.Unmarshal(j.data, &v)
+		if err == nil {
+			err = errors.New("invalid JSON")
+		}
+		return nil, fmt.Errorf(invalidJsonFmt, err)
+	}
+	return j.data, nil
+}
+
+// resolveInput() answers v, decoding it to a generic value if it
+// is JSON text. Anything else is answered unchanged.
+func resolveInput(v interface{}) (interface{}, error) {
+	var data []byte
+	switch t := v.(type) {
+	case jsonInput:
+		b, err := t.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	case json.RawMessage:
+		data = t
+	case *json.RawMessage:
+		if t == nil {
+			return nil, nil
+		}
+		data = *t
+	default:
+		return v, nil
+	}
+	var ans interface{}
+	err := unmarshalJson(data, &ans)
+	if err != nil {
+		return nil, fmt.Errorf(invalidJsonFmt, err)
+	}
+	return ans, nil
+}
+
 // ------------------------------------------------------------
 // TO-JSON
 
@@ -43,3 +119,10 @@ func toJson(d interface{}) interface{} {
 	}
 	return string(b)
 }
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	invalidJsonFmt = "jacl: invalid JSON input: %w"
+)
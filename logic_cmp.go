@@ -0,0 +1,119 @@
+package jacl
+
+import (
+	"errors"
+)
+
+// ------------------------------------------------------------
+// ALL-CMP
+
+// allCmp requires every Cmper to pass.
+type allCmp struct {
+	Cmps []CmperFactory `json:"cmps,omitempty"`
+}
+
+func (c allCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+func (c allCmp) cmpScoped(b interface{}, sc *varScope) error {
+	branches := make([]*ComparisonError, len(c.Cmps))
+	failed := false
+	for i, cmp := range c.Cmps {
+		err := cmp.cmpScoped(b, sc)
+		if err == nil {
+			continue
+		}
+		var ce *ComparisonError
+		if !errors.As(err, &ce) {
+			return err
+		}
+		branches[i] = ce
+		failed = true
+	}
+	if !failed {
+		return nil
+	}
+	return newBranchError(ReasonAll, branches)
+}
+
+func (c allCmp) SerializeKey() string {
+	return allCmpFactoryKey
+}
+
+// ------------------------------------------------------------
+// ANY-OF-CMP
+
+// anyOfCmp requires at least one Cmper to pass. A branch that
+// can't be evaluated counts as failing, so alternatives can
+// describe documents with different shapes.
+type anyOfCmp struct {
+	Cmps []CmperFactory `json:"cmps,omitempty"`
+}
+
+func (c anyOfCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+// cmpScoped() keeps the captures of the first branch to pass.
+func (c anyOfCmp) cmpScoped(b interface{}, sc *varScope) error {
+	branches := make([]*ComparisonError, len(c.Cmps))
+	for i, cmp := range c.Cmps {
+		err := cmp.cmpScoped(b, sc)
+		if err == nil {
+			return nil
+		}
+		var ce *ComparisonError
+		if !errors.As(err, &ce) {
+			ce = &ComparisonError{s: err.Error()}
+		}
+		branches[i] = ce
+	}
+	return newBranchError(ReasonAnyOf, branches)
+}
+
+func (c anyOfCmp) SerializeKey() string {
+	return anyOfCmpFactoryKey
+}
+
+// ------------------------------------------------------------
+// NOT-CMP
+
+// notCmp requires the Cmper to fail.
+type notCmp struct {
+	Inner CmperFactory `json:"cmp,omitempty"`
+}
+
+func (c notCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+// cmpScoped() discards the captures of the inner Cmper, which
+// only pass when the comparison fails.
+func (c notCmp) cmpScoped(b interface{}, sc *varScope) error {
+	err := c.Inner.cmpScoped(b, sc.fork())
+	if err == nil {
+		return newMismatchError("", ReasonNot, nil, nil)
+	}
+	var ce *ComparisonError
+	if errors.As(err, &ce) {
+		return nil
+	}
+	return err
+}
+
+func (c notCmp) SerializeKey() string {
+	return notCmpFactoryKey
+}
+
+// ------------------------------------------------------------
+// FUNCS
+
+// toCmperFactories() wraps each Cmper in a factory.
+func toCmperFactories(cmps []Cmper) []CmperFactory {
+	factories := make([]CmperFactory, 0, len(cmps))
+	for _, c := range cmps {
+		factories = append(factories, CmperFactory{Cmper: c})
+	}
+	return factories
+}
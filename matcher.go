@@ -0,0 +1,596 @@
+package jacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// MATCHER
+
+// Matcher matches a single value in B. Matchers can be placed
+// anywhere in the values passed to Cmp() and Cmps(), at any depth.
+//
+// Comparisons can be serialized, so a Matcher must also marshal
+// to a marker the comparison can recognize. Custom matchers
+// implement MarshalJSON() with MarshalMatcher(), or leave it out
+// to have their fields marshalled with the marker added, and are
+// made available with Register().
+type Matcher interface {
+	// Answer nil if v matches, an error describing the failure
+	// otherwise. v has been reduced to a generic JSON value: nil,
+	// bool, json.Number, string, []interface{} or map[string]interface{}.
+	Match(v interface{}) error
+
+	// Answer a unique key so I can be reinstantiated after marshalling.
+	FactoryKey() string
+}
+
+// missingMatcher is a Matcher that also decides whether a missing
+// value matches. Other matchers only see values that exist.
+type missingMatcher interface {
+	Matcher
+	// Answer nil if v matches, or the reason and an error describing
+	// the failure. exists is false if there is no value at all.
+	matchPresence(v interface{}, exists bool) (Reason, error)
+}
+
+// MarshalMatcher answers the marker representation of a matcher,
+// which is the matcher's fields plus its factory key. The marker
+// survives serializing the comparison. Supply a type
+// without a MarshalJSON() method for the fields, to avoid recursion.
+func MarshalMatcher(key string, fields interface{}) ([]byte, error) {
+	m := make(map[string]interface{})
+	err := toFromJson(fields, &m)
+	if err != nil {
+		return nil, err
+	}
+	m[matcherMarker] = key
+	return json.Marshal(m)
+}
+
+// markMatcher() answers m, wrapped to marshal to a marker if it
+// has no MarshalJSON() of its own.
+func markMatcher(m Matcher) Matcher {
+	if _, ok := m.(json.Marshaler); ok {
+		return m
+	}
+	return markedMatcher{m}
+}
+
+// markedMatcher marshals a custom matcher without a MarshalJSON()
+// to a marker, so it isn't reloaded as a plain object.
+type markedMatcher struct {
+	Matcher
+}
+
+func (m markedMatcher) MarshalJSON() ([]byte, error) {
+	return MarshalMatcher(m.FactoryKey(), m.Matcher)
+}
+
+// asMatcher() answers the matcher represented by v, if any.
+// This is either a Matcher or a marker produced by MarshalMatcher().
+func asMatcher(v interface{}) (Matcher, bool, error) {
+	switch t := v.(type) {
+	case Matcher:
+		return t, true, nil
+	case map[string]interface{}:
+		key, ok := t[matcherMarker].(string)
+		if !ok {
+			return nil, false, nil
+		}
+		m, err := matcherFromMarker(key, t)
+		return m, true, err
+	}
+	return nil, false, nil
+}
+
+// matcherFromMarker() reinstantiates a matcher from its marker.
+func matcherFromMarker(key string, marker map[string]interface{}) (Matcher, error) {
+	v, err := newRegistered(key)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(Matcher)
+	if !ok {
+		return nil, fmt.Errorf("jacl: %v is not a Matcher", key)
+	}
+	fields := make(map[string]interface{})
+	for k, v := range marker {
+		if k != matcherMarker {
+			fields[k] = v
+		}
+	}
+	err = toFromJson(fields, m)
+	return m, err
+}
+
+// ------------------------------------------------------------
+// ANY-MATCHER
+
+// anyMatcher matches any value.
+type anyMatcher struct {
+}
+
+func (m anyMatcher) Match(v interface{}) error {
+	return nil
+}
+
+func (m anyMatcher) FactoryKey() string {
+	return anyMatcherKey
+}
+
+func (m anyMatcher) MarshalJSON() ([]byte, error) {
+	type glue anyMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// REGEX-MATCHER
+
+// regexMatcher matches strings against a regular expression.
+// re is compiled by Regex() and UnmarshalJSON().
+type regexMatcher struct {
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+}
+
+func (m regexMatcher) Match(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(wantStringFmt)
+	}
+	if !m.re.MatchString(s) {
+		return fmt.Errorf("want match for %v", m.Pattern)
+	}
+	return nil
+}
+
+func (m regexMatcher) FactoryKey() string {
+	return regexMatcherKey
+}
+
+// cachedRegex() answers the compiled pattern, compiling it only
+// the first time it is seen.
+func cachedRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := regexCache.LoadOrStore(pattern, re)
+	return cached.(*regexp.Regexp), nil
+}
+
+func (m regexMatcher) MarshalJSON() ([]byte, error) {
+	type glue regexMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// UnmarshalJSON() compiles the pattern, so an invalid pattern is
+// reported as the matcher is loaded.
+func (m *regexMatcher) UnmarshalJSON(data []byte) error {
+	type glue regexMatcher
+	var g glue
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return err
+	}
+	re, err := cachedRegex(g.Pattern)
+	if err != nil {
+		return fmt.Errorf("pattern: %w", err)
+	}
+	*m = regexMatcher(g)
+	m.re = re
+	return nil
+}
+
+// ------------------------------------------------------------
+// ONE-OF-MATCHER
+
+// oneOfMatcher matches any one of a list of values.
+type oneOfMatcher struct {
+	Values []interface{} `json:"values"`
+}
+
+func (m oneOfMatcher) Match(v interface{}) error {
+	values, err := normalizeSlice(m.Values)
+	if err != nil {
+		return err
+	}
+	for _, a := range values {
+		if compare("", a, v) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("want one of %v", toJson(m.Values))
+}
+
+func (m oneOfMatcher) FactoryKey() string {
+	return oneOfMatcherKey
+}
+
+func (m oneOfMatcher) MarshalJSON() ([]byte, error) {
+	type glue oneOfMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// RANGE-MATCHER
+
+// rangeMatcher matches numbers in an inclusive range. The limits
+// are compared exactly, like other numbers.
+type rangeMatcher struct {
+	Min json.Number `json:"min"`
+	Max json.Number `json:"max"`
+}
+
+func (m rangeMatcher) Match(v interface{}) error {
+	n, ok := toNumber(v)
+	if !ok {
+		return fmt.Errorf(wantNumberFmt)
+	}
+	lo, lok := orderNumbers(n, m.Min)
+	hi, hok := orderNumbers(n, m.Max)
+	if !lok || !hok || lo < 0 || hi > 0 {
+		return fmt.Errorf("want range %v to %v", m.Min, m.Max)
+	}
+	return nil
+}
+
+func (m rangeMatcher) FactoryKey() string {
+	return rangeMatcherKey
+}
+
+func (m rangeMatcher) MarshalJSON() ([]byte, error) {
+	type glue rangeMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// APPROX-MATCHER
+
+// approxMatcher matches numbers within a tolerance of a value.
+type approxMatcher struct {
+	Value float64 `json:"value"`
+	Abs   float64 `json:"abs,omitempty"`
+	Rel   float64 `json:"rel,omitempty"`
+}
+
+func (m approxMatcher) Match(v interface{}) error {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Errorf(wantNumberFmt)
+	}
+	if !withinTolerance(m.Value, f, m.Abs, m.Rel) {
+		return fmt.Errorf("want %v within abs %v rel %v", m.Value, m.Abs, m.Rel)
+	}
+	return nil
+}
+
+func (m approxMatcher) FactoryKey() string {
+	return approxMatcherKey
+}
+
+func (m approxMatcher) MarshalJSON() ([]byte, error) {
+	type glue approxMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// PREFIX-MATCHER
+
+// prefixMatcher matches strings that start with a prefix.
+type prefixMatcher struct {
+	Prefix string `json:"prefix"`
+}
+
+func (m prefixMatcher) Match(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(wantStringFmt)
+	}
+	if !strings.HasPrefix(s, m.Prefix) {
+		return fmt.Errorf("want prefix %q", m.Prefix)
+	}
+	return nil
+}
+
+func (m prefixMatcher) FactoryKey() string {
+	return prefixMatcherKey
+}
+
+func (m prefixMatcher) MarshalJSON() ([]byte, error) {
+	type glue prefixMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// SUFFIX-MATCHER
+
+// suffixMatcher matches strings that end with a suffix.
+type suffixMatcher struct {
+	Suffix string `json:"suffix"`
+}
+
+func (m suffixMatcher) Match(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(wantStringFmt)
+	}
+	if !strings.HasSuffix(s, m.Suffix) {
+		return fmt.Errorf("want suffix %q", m.Suffix)
+	}
+	return nil
+}
+
+func (m suffixMatcher) FactoryKey() string {
+	return suffixMatcherKey
+}
+
+func (m suffixMatcher) MarshalJSON() ([]byte, error) {
+	type glue suffixMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// CONTAINS-MATCHER
+
+// containsMatcher matches strings that contain a substring.
+type containsMatcher struct {
+	Substr string `json:"substr"`
+}
+
+func (m containsMatcher) Match(v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(wantStringFmt)
+	}
+	if !strings.Contains(s, m.Substr) {
+		return fmt.Errorf("want contains %q", m.Substr)
+	}
+	return nil
+}
+
+func (m containsMatcher) FactoryKey() string {
+	return containsMatcherKey
+}
+
+func (m containsMatcher) MarshalJSON() ([]byte, error) {
+	type glue containsMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// NOT-EMPTY-MATCHER
+
+// notEmptyMatcher matches anything but null and empty strings,
+// arrays and objects.
+type notEmptyMatcher struct {
+}
+
+func (m notEmptyMatcher) Match(v interface{}) error {
+	empty := false
+	switch t := v.(type) {
+	case nil:
+		empty = true
+	case string:
+		empty = len(t) < 1
+	case []interface{}:
+		empty = len(t) < 1
+	case map[string]interface{}:
+		empty = len(t) < 1
+	}
+	if empty {
+		return fmt.Errorf("want not empty")
+	}
+	return nil
+}
+
+func (m notEmptyMatcher) FactoryKey() string {
+	return notEmptyMatcherKey
+}
+
+func (m notEmptyMatcher) MarshalJSON() ([]byte, error) {
+	type glue notEmptyMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// PRESENCE-MATCHER
+
+// presenceMatcher matches null, a missing value, or either.
+// The configuration is implied by the factory key.
+type presenceMatcher struct {
+	Null    bool `json:"-"`
+	Missing bool `json:"-"`
+}
+
+func (m presenceMatcher) Match(v interface{}) error {
+	_, err := m.matchPresence(v, true)
+	return err
+}
+
+func (m presenceMatcher) matchPresence(v interface{}, exists bool) (Reason, error) {
+	switch {
+	case !exists && m.Missing, exists && v == nil && m.Null:
+		return ReasonUnknown, nil
+	case !exists:
+		return ReasonMissing, fmt.Errorf("missing, want %v", m.describe())
+	case v == nil:
+		return ReasonExists, fmt.Errorf("have null want %v", m.describe())
+	case m.Null:
+		return ReasonType, fmt.Errorf("have %v want %v", toJson(v), m.describe())
+	}
+	return ReasonExists, fmt.Errorf("have %v want %v", toJson(v), m.describe())
+}
+
+func (m presenceMatcher) FactoryKey() string {
+	switch {
+	case m.Null && m.Missing:
+		return isNullOrMissingMatcherKey
+	case m.Missing:
+		return isMissingMatcherKey
+	}
+	return isNullMatcherKey
+}
+
+func (m presenceMatcher) MarshalJSON() ([]byte, error) {
+	return MarshalMatcher(m.FactoryKey(), struct{}{})
+}
+
+// describe() answers what the matcher wants, for example "null".
+func (m presenceMatcher) describe() string {
+	switch {
+	case m.Null && m.Missing:
+		return "null or missing"
+	case m.Missing:
+		return "missing"
+	}
+	return TypeNull
+}
+
+// ------------------------------------------------------------
+// TYPE-IS-MATCHER
+
+// typeIsMatcher matches values of a JSON type.
+type typeIsMatcher struct {
+	Type string `json:"type"`
+}
+
+func (m typeIsMatcher) Match(v interface{}) error {
+	if jsonTypeOf(v) != m.Type {
+		return fmt.Errorf("want type %v", m.Type)
+	}
+	return nil
+}
+
+func (m typeIsMatcher) FactoryKey() string {
+	return typeIsMatcherKey
+}
+
+func (m typeIsMatcher) MarshalJSON() ([]byte, error) {
+	type glue typeIsMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// UnmarshalJSON() validates the type, so an unknown type is
+// reported as the matcher is loaded.
+func (m *typeIsMatcher) UnmarshalJSON(data []byte) error {
+	type glue typeIsMatcher
+	var g glue
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return err
+	}
+	if err = checkJsonType(g.Type); err != nil {
+		return fmt.Errorf("type: %w", err)
+	}
+	*m = typeIsMatcher(g)
+	return nil
+}
+
+// checkJsonType() answers an error if t is not one of the JSON
+// types supported by TypeIs().
+func checkJsonType(t string) error {
+	switch t {
+	case TypeNull, TypeBool, TypeNumber, TypeString, TypeArray, TypeObject:
+		return nil
+	}
+	return fmt.Errorf("unknown type %v", t)
+}
+
+// jsonTypeOf() answers the JSON type name of a generic value.
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBool
+	case json.Number, float64:
+		return TypeNumber
+	case string:
+		return TypeString
+	case []interface{}:
+		return TypeArray
+	case map[string]interface{}:
+		return TypeObject
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// toNumber() answers v as a json.Number, if it is a number.
+func toNumber(v interface{}) (json.Number, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		return t, true
+	case float64:
+		return floatNumber(t), true
+	}
+	return "", false
+}
+
+// floatNumber() answers f as a json.Number. Infinities are kept,
+// so they can still be ordered.
+func floatNumber(f float64) json.Number {
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// toFloat() answers a generic number as a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case float64:
+		return t, true
+	}
+	return 0, false
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+// The JSON types supported by TypeIs().
+const (
+	TypeNull   = "null"
+	TypeBool   = "bool"
+	TypeNumber = "number"
+	TypeString = "string"
+	TypeArray  = "array"
+	TypeObject = "object"
+)
+
+const (
+	// The key that identifies a marshalled matcher.
+	matcherMarker = "$jacl"
+
+	anyMatcherKey      = "jacl-any"
+	regexMatcherKey    = "jacl-regex"
+	oneOfMatcherKey    = "jacl-oneof"
+	rangeMatcherKey    = "jacl-range"
+	approxMatcherKey   = "jacl-approx"
+	prefixMatcherKey   = "jacl-prefix"
+	suffixMatcherKey   = "jacl-suffix"
+	containsMatcherKey = "jacl-contains"
+	notEmptyMatcherKey = "jacl-notempty"
+	typeIsMatcherKey   = "jacl-typeis"
+
+	isNullMatcherKey          = "jacl-isnull"
+	isMissingMatcherKey       = "jacl-ismissing"
+	isNullOrMissingMatcherKey = "jacl-isnullormissing"
+
+	wantStringFmt = "want string"
+	wantNumberFmt = "want number"
+)
+
+var (
+	// Compiled regexMatcher patterns, keyed by pattern.
+	regexCache sync.Map
+)
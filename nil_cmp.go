@@ -12,7 +12,11 @@ import (
 type nilCmp struct {
 }
 
-func (c nilCmp) Cmp(b interface{}) error {
+func (c nilCmp) Cmp(_b interface{}) error {
+	b, err := resolveInput(_b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
 	if !isNilInterface(b) {
 		return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(b), `nil`))
 	}
@@ -0,0 +1,561 @@
+package jacl
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// NORMALIZE
+
+// normalize() reduces v to a generic JSON value: nil, bool,
+// json.Number, string, []interface{} or map[string]interface{}.
+// The result is what a JSON round trip would produce, but Go
+// values are walked directly instead of marshalled. Matchers
+// are kept as-is, so they don't need to be reinstantiated.
+func normalize(v interface{}) (interface{}, error) {
+	return walker{}.value(v, 0)
+}
+
+// normalizeMap() normalizes v, which must be an object or null.
+func normalizeMap(v interface{}) (map[string]interface{}, error) {
+	return walker{}.rootMap(v)
+}
+
+// normalizeSlice() normalizes v, which must be an array or null.
+func normalizeSlice(v interface{}) ([]interface{}, error) {
+	return walker{}.rootSlice(v)
+}
+
+// ------------------------------------------------------------
+// WALKER
+
+// walker walks Go values to normalize them. The options change
+// which struct fields are included.
+type walker struct {
+	// Include zero bools, numbers and strings, despite omitempty.
+	includeZero bool
+}
+
+// newWalker() answers a walker for the comparison options.
+func newWalker(opts cmpOpts) walker {
+	return walker{includeZero: opts.IncludeZero}
+}
+
+// root() normalizes v.
+func (w walker) root(v interface{}) (interface{}, error) {
+	return w.value(v, 0)
+}
+
+// rootMap() normalizes v, which must be an object or null.
+func (w walker) rootMap(v interface{}) (map[string]interface{}, error) {
+	n, err := w.value(v, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch t := n.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return t, nil
+	}
+	return nil, fmt.Errorf(normalizeKindFmt, jsonTypeOf(n), TypeObject)
+}
+
+// rootSlice() normalizes v, which must be an array or null.
+func (w walker) rootSlice(v interface{}) ([]interface{}, error) {
+	n, err := w.value(v, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch t := n.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return t, nil
+	}
+	return nil, fmt.Errorf(normalizeKindFmt, jsonTypeOf(n), TypeArray)
+}
+
+// value() normalizes v. The common generic types are
+// handled without reflection.
+func (w walker) value(v interface{}, depth int) (interface{}, error) {
+	if depth > maxNormalizeDepth {
+		return nil, errors.New("jacl: value is too deep, possibly cyclic")
+	}
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case string, bool, json.Number:
+		return t, nil
+	case Matcher:
+		return markMatcher(t), nil
+	case jsonInput, json.RawMessage, *json.RawMessage:
+		return resolveInput(t)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			n, err := w.value(e, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = n
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			n, err := w.value(e, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = n
+		}
+		return s, nil
+	}
+	return w.reflectValue(reflect.ValueOf(v), depth)
+}
+
+// reflectValue() normalizes v, following the rules of
+// encoding/json.
+func (w walker) reflectValue(v reflect.Value, depth int) (interface{}, error) {
+	if depth > maxNormalizeDepth {
+		return nil, errors.New("jacl: value is too deep, possibly cyclic")
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		return w.value(v.Elem().Interface(), depth+1)
+	}
+
+	// Custom encodings. Pointer receivers are only used on
+	// addressable values, as with encoding/json.
+	if t.Implements(matcherType) || t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		return w.custom(v.Interface(), depth)
+	}
+	if t.Kind() != reflect.Ptr && v.CanAddr() {
+		pt := reflect.PtrTo(t)
+		if pt.Implements(matcherType) || pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType) {
+			return w.custom(v.Addr().Interface(), depth)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float(), t.Bits())
+	case reflect.String:
+		if t == numberType {
+			return json.Number(v.String()), nil
+		}
+		return v.String(), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return w.reflectValue(v.Elem(), depth+1)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return w.reflectMap(v, depth)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 && !isCustomEncoded(t.Elem()) {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		return w.reflectSlice(v, depth)
+	case reflect.Array:
+		return w.reflectSlice(v, depth)
+	case reflect.Struct:
+		return w.reflectStruct(v, depth)
+	}
+	return nil, fmt.Errorf("json: unsupported type: %v", t)
+}
+
+// custom() normalizes a value with its own encoding.
+func (w walker) custom(v interface{}, depth int) (interface{}, error) {
+	switch t := v.(type) {
+	case Matcher:
+		return markMatcher(t), nil
+	case json.Marshaler:
+		b, err := t.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var ans interface{}
+		err = unmarshalJson(b, &ans)
+		if err != nil {
+			return nil, fmt.Errorf("jacl: invalid JSON from %T: %w", v, err)
+		}
+		return w.value(ans, depth+1)
+	case encoding.TextMarshaler:
+		b, err := t.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return nil, fmt.Errorf("json: unsupported type: %T", v)
+}
+
+func (w walker) reflectMap(v reflect.Value, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := mapKeyString(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		n, err := w.reflectValue(iter.Value(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = n
+	}
+	return m, nil
+}
+
+func (w walker) reflectSlice(v reflect.Value, depth int) (interface{}, error) {
+	s := make([]interface{}, v.Len())
+	for i := range s {
+		n, err := w.reflectValue(v.Index(i), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		s[i] = n
+	}
+	return s, nil
+}
+
+func (w walker) reflectStruct(v reflect.Value, depth int) (interface{}, error) {
+	fields := cachedStructFields(v.Type())
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && !f.required && isEmptyValue(fv) && !(w.includeZero && isZeroScalar(fv))) {
+			continue
+		}
+		n, err := w.reflectValue(fv, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if f.quoted {
+			n = quoteValue(n)
+		}
+		m[f.name] = n
+	}
+	return m, nil
+}
+
+// mapKeyString() answers the object key for a map key, as
+// encoding/json would.
+func mapKeyString(k reflect.Value) (string, error) {
+	// A key of a string kind is used as is, even if it has a
+	// text encoding.
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("json: unsupported type: %v", k.Type())
+}
+
+// formatFloat() formats f the way encoding/json does.
+func formatFloat(f float64, bits int) (interface{}, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("json: unsupported value: %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	s := strconv.FormatFloat(f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	return json.Number(s), nil
+}
+
+// quoteValue() applies the ",string" tag option to a normalized
+// scalar.
+func quoteValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return string(t)
+	}
+	return v
+}
+
+func isCustomEncoded(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isZeroScalar() answers true if v is a zero bool, number or string.
+func isZeroScalar(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return isEmptyValue(v)
+	}
+	return false
+}
+
+// fieldByIndex() answers the field at index, or false if it is
+// reached through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// ------------------------------------------------------------
+// STRUCT-FIELDS
+
+// structField is a single encoded field of a struct.
+type structField struct {
+	name      string
+	tagged    bool
+	index     []int
+	omitEmpty bool
+	quoted    bool
+	required  bool
+}
+
+// cachedStructFields() answers the encoded fields of t.
+func cachedStructFields(t reflect.Type) []structField {
+	if f, ok := structFieldCache.Load(t); ok {
+		return f.([]structField)
+	}
+	f, _ := structFieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]structField)
+}
+
+// typeFields() answers the encoded fields of t. Fields of embedded structs
+// are promoted, and Go's visibility rules decide between fields
+// with the same name.
+func typeFields(t reflect.Type) []structField {
+	type candidate struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []structField
+	current := []candidate{}
+	next := []candidate{{typ: t}}
+	visited := map[reflect.Type]bool{}
+	hidden := map[string]bool{}
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		var level []structField
+		for _, c := range current {
+			if visited[c.typ] {
+				continue
+			}
+			visited[c.typ] = true
+			for i := 0; i < c.typ.NumField(); i++ {
+				sf := c.typ.Field(i)
+				ft := sf.Type
+				if sf.Anonymous {
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseJsonTag(tag)
+				index := make([]int, len(c.index)+1)
+				copy(index, c.index)
+				index[len(c.index)] = i
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, candidate{typ: ft, index: index})
+					continue
+				}
+				f := structField{name: name, tagged: name != "", index: index}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				f.omitEmpty = opts.contains("omitempty")
+				f.required = jsonTagOptions(sf.Tag.Get("jacl")).contains(requiredTag)
+				if opts.contains("string") {
+					// The option also applies through an unnamed pointer.
+					qt := ft
+					if qt.Name() == "" && qt.Kind() == reflect.Ptr {
+						qt = qt.Elem()
+					}
+					switch qt.Kind() {
+					case reflect.Bool, reflect.String,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64:
+						f.quoted = true
+					}
+				}
+				level = append(level, f)
+			}
+		}
+		// Shallower fields hide deeper ones. At the same depth a
+		// single tagged field wins, otherwise the name is dropped.
+		for _, name := range levelNames(level) {
+			if hidden[name] {
+				continue
+			}
+			if f, ok := dominantField(level, name); ok {
+				fields = append(fields, f)
+			}
+			hidden[name] = true
+		}
+	}
+	return fields
+}
+
+// levelNames() answers the distinct names in fields, in order.
+func levelNames(fields []structField) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if !seen[f.name] {
+			seen[f.name] = true
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// dominantField() answers the field that wins for name.
+func dominantField(fields []structField, name string) (structField, bool) {
+	var ans []structField
+	for _, f := range fields {
+		if f.name == name {
+			ans = append(ans, f)
+		}
+	}
+	if len(ans) == 1 {
+		return ans[0], true
+	}
+	var tagged []structField
+	for _, f := range ans {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return structField{}, false
+}
+
+// jsonTagOptions are the options following the name in a json tag.
+type jsonTagOptions string
+
+func parseJsonTag(tag string) (string, jsonTagOptions) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], jsonTagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+func (o jsonTagOptions) contains(name string) bool {
+	for _, s := range strings.Split(string(o), ",") {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	maxNormalizeDepth = 1000
+	requiredTag       = "required"
+	normalizeKindFmt  = "jacl: have %v want %v"
+)
+
+var (
+	matcherType       = reflect.TypeOf((*Matcher)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	numberType        = reflect.TypeOf(json.Number(""))
+
+	structFieldCache sync.Map
+)
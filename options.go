@@ -0,0 +1,110 @@
+package jacl
+
+import (
+	"fmt"
+)
+
+// ------------------------------------------------------------
+// CMP-OPTS
+
+// cmpOpts collects the options that control a comparison.
+type cmpOpts struct {
+	// All reports every mismatch instead of stopping at the first.
+	All bool `json:"all,omitempty"`
+	// Abs and Rel are the absolute and relative tolerances
+	// used when comparing numbers.
+	Abs float64 `json:"abs,omitempty"`
+	Rel float64 `json:"rel,omitempty"`
+	// Unordered compares slices by content instead of by index.
+	Unordered bool `json:"unordered,omitempty"`
+	// Strict fails on values in B that are not in A, except
+	// below the Open paths.
+	Strict bool     `json:"strict,omitempty"`
+	Open   []string `json:"open,omitempty"`
+	// IncludeZero keeps zero fields that are tagged omitempty.
+	IncludeZero bool `json:"includeZero,omitempty"`
+	// vars stores values for Capture() and Ref(). It is not
+	// serialized.
+	vars *Vars
+}
+
+// ------------------------------------------------------------
+// OPTION
+
+// option defines values that can be passed to Cmp() and Cmps()
+// to configure the comparison.
+type option interface {
+	applyTo(opts *cmpOpts)
+}
+
+// applyOptions() applies each option to dst. It panics if
+// anything else is supplied.
+func applyOptions(dst *cmpOpts, opts []interface{}) {
+	for _, o := range opts {
+		ot, ok := o.(option)
+		if !ok {
+			panic(fmt.Errorf("unknown option %T", o))
+		}
+		ot.applyTo(dst)
+	}
+}
+
+// ------------------------------------------------------------
+// ALL-ERRORS-OPT OPTION
+
+// allErrorsOpt collects all mismatches.
+type allErrorsOpt struct {
+}
+
+func (o allErrorsOpt) applyTo(opts *cmpOpts) {
+	opts.All = true
+}
+
+// ------------------------------------------------------------
+// TOLERANCE-OPT OPTION
+
+// toleranceOpt sets the tolerance for numeric comparisons.
+type toleranceOpt struct {
+	Abs float64
+	Rel float64
+}
+
+func (o toleranceOpt) applyTo(opts *cmpOpts) {
+	opts.Abs = o.Abs
+	opts.Rel = o.Rel
+}
+
+// ------------------------------------------------------------
+// UNORDERED-OPT OPTION
+
+// unorderedOpt compares slices regardless of order.
+type unorderedOpt struct {
+}
+
+func (o unorderedOpt) applyTo(opts *cmpOpts) {
+	opts.Unordered = true
+}
+
+// ------------------------------------------------------------
+// STRICT-OPT OPTION
+
+// strictOpt fails on extra values.
+type strictOpt struct {
+	Open []string
+}
+
+func (o strictOpt) applyTo(opts *cmpOpts) {
+	opts.Strict = true
+	opts.Open = append(opts.Open, o.Open...)
+}
+
+// ------------------------------------------------------------
+// INCLUDE-ZERO-OPT OPTION
+
+// includeZeroOpt keeps zero values in structs.
+type includeZeroOpt struct {
+}
+
+func (o includeZeroOpt) applyTo(opts *cmpOpts) {
+	opts.IncludeZero = true
+}
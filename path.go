@@ -0,0 +1,122 @@
+package jacl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ------------------------------------------------------------
+// PATH
+
+// joinKey() appends a map key to a path. Keys that would make
+// the path ambiguous are quoted.
+func joinKey(path, key string) string {
+	if key == "" || strings.ContainsAny(key, `.[]"`) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// joinIndex() appends a slice index to a path.
+func joinIndex(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
+
+// joinPath() appends a path to a prefix path.
+func joinPath(prefix, path string) string {
+	if prefix == "" || path == "" {
+		return prefix + path
+	}
+	if strings.HasPrefix(path, "[") || strings.HasPrefix(path, "/") {
+		return prefix + path
+	}
+	return prefix + "." + path
+}
+
+// joinPointer() appends a token to a JSON Pointer.
+func joinPointer(ptr, token string) string {
+	return ptr + "/" + pointerEscaper.Replace(token)
+}
+
+// splitKeyPath() splits a key path into its segments. A path
+// starting with a slash is a JSON Pointer, anything else is a
+// dotted path such as owner.id.
+func splitKeyPath(path string) []string {
+	if strings.HasPrefix(path, "/") {
+		return splitPointer(path)
+	}
+	return strings.Split(path, ".")
+}
+
+// splitPointer() splits a JSON Pointer into its unescaped tokens.
+// The empty pointer refers to the whole document.
+func splitPointer(ptr string) []string {
+	if ptr == "" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(ptr, "/"), "/")
+	for i, t := range tokens {
+		tokens[i] = pointerUnescaper.Replace(t)
+	}
+	return tokens
+}
+
+// lookupKey() answers the value of a Key() field in v. A field
+// named by the whole key is preferred, so a key such as a.b still
+// finds a literal "a.b" field. Otherwise the segments of the key,
+// from splitKeyPath(), are followed.
+func lookupKey(v map[string]interface{}, key string, segments []string) (interface{}, bool) {
+	if e, ok := v[key]; ok {
+		return e, true
+	}
+	return lookupPath(v, segments)
+}
+
+// lookupPath() answers the value found by following segments
+// down from v. Segments index into objects by key and into
+// arrays by position.
+func lookupPath(v interface{}, segments []string) (interface{}, bool) {
+	for _, seg := range segments {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			next, ok := t[seg]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// compileOpenPaths() compiles path patterns into regular expressions
+// that match the path and everything below it. A [*] in a pattern
+// matches any index.
+func compileOpenPaths(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		expr := strings.ReplaceAll(regexp.QuoteMeta(p), `\[\*\]`, `\[\d+\]`)
+		res = append(res, regexp.MustCompile(`^`+expr+`($|[.\[])`))
+	}
+	return res
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
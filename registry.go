@@ -0,0 +1,84 @@
+package jacl
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// REGISTRY
+
+// Register makes a Cmper, CmpsFunc or Matcher available for
+// unmarshalling. The key must match the one the type reports
+// (SerializeKey() for a Cmper, FactoryKey() for a CmpsFunc or
+// Matcher), and the constructor must answer a pointer to a new
+// instance that the marshalled fields can be decoded into.
+// Register panics if the key is empty or already registered.
+func Register(key string, fn func() interface{}) {
+	if key == "" || fn == nil {
+		panic("jacl: Register requires a key and constructor")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[key]; ok {
+		panic(fmt.Errorf("jacl: Register called twice for %v", key))
+	}
+	registry[key] = fn
+}
+
+// newRegistered() answers a new instance of the type registered
+// under key, or an error if there is none.
+func newRegistered(key string) (interface{}, error) {
+	registryMu.RLock()
+	fn, ok := registry[key]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("jacl: unknown key %v", key)
+	}
+	return fn(), nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() interface{}{
+		// Cmpers
+		nilCmpFactoryKey:    func() interface{} { return &nilCmp{} },
+		singleCmpFactoryKey: func() interface{} { return &singleCmp{} },
+		sliceCmpFactoryKey:  func() interface{} { return &sliceCmp{} },
+		goldenCmpFactoryKey: func() interface{} { return &goldenCmp{} },
+		httpCmpFactoryKey:   func() interface{} { return &httpCmp{} },
+		atCmpFactoryKey:     func() interface{} { return &atCmp{} },
+		allCmpFactoryKey:    func() interface{} { return &allCmp{} },
+		anyOfCmpFactoryKey:  func() interface{} { return &anyOfCmp{} },
+		notCmpFactoryKey:    func() interface{} { return &notCmp{} },
+		schemaCmpFactoryKey: func() interface{} { return &schemaCmp{} },
+		// CmpsFuncs
+		keyFactoryKey:       func() interface{} { return &keyFn{} },
+		notExistsFactoryKey: func() interface{} { return &notExistsFn{} },
+		sizeisFactoryKey:    func() interface{} { return &sizeisFn{} },
+		eachFactoryKey:      func() interface{} { return &eachFn{} },
+		noneFactoryKey:      func() interface{} { return &noneFn{} },
+		countFactoryKey:     func() interface{} { return &countFn{} },
+		// Matchers
+		anyMatcherKey:      func() interface{} { return &anyMatcher{} },
+		regexMatcherKey:    func() interface{} { return &regexMatcher{} },
+		oneOfMatcherKey:    func() interface{} { return &oneOfMatcher{} },
+		rangeMatcherKey:    func() interface{} { return &rangeMatcher{} },
+		approxMatcherKey:   func() interface{} { return &approxMatcher{} },
+		prefixMatcherKey:   func() interface{} { return &prefixMatcher{} },
+		suffixMatcherKey:   func() interface{} { return &suffixMatcher{} },
+		containsMatcherKey: func() interface{} { return &containsMatcher{} },
+		notEmptyMatcherKey: func() interface{} { return &notEmptyMatcher{} },
+		typeIsMatcherKey:   func() interface{} { return &typeIsMatcher{} },
+		// Presence matchers
+		isNullMatcherKey:          func() interface{} { return &presenceMatcher{Null: true} },
+		isMissingMatcherKey:       func() interface{} { return &presenceMatcher{Missing: true} },
+		isNullOrMissingMatcherKey: func() interface{} { return &presenceMatcher{Null: true, Missing: true} },
+		// Vars matchers
+		captureMatcherKey: func() interface{} { return &captureMatcher{} },
+		refMatcherKey:     func() interface{} { return &refMatcher{} },
+	}
+)
@@ -0,0 +1,403 @@
+package jacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ------------------------------------------------------------
+// SCHEMA-CMP
+
+// schemaCmp validates B against a JSON Schema.
+type schemaCmp struct {
+	Schema json.RawMessage `json:"schema"`
+	// The compiled Schema, set by Schema() and UnmarshalJSON().
+	root *schemaNode
+}
+
+func (c schemaCmp) Cmp(_b interface{}) error {
+	root := c.root
+	if root == nil {
+		var err error
+		if root, err = compileSchema(c.Schema); err != nil {
+			return newEvaluationError(err)
+		}
+	}
+	b, err := normalize(_b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	// Every violation is reported, as other validators do.
+	s := newCmpState(cmpOpts{All: true})
+	root.validate(s, "", b)
+	return s.err()
+}
+
+func (c schemaCmp) SerializeKey() string {
+	return schemaCmpFactoryKey
+}
+
+// UnmarshalJSON() compiles the schema once, as it is loaded.
+func (c *schemaCmp) UnmarshalJSON(data []byte) error {
+	type glue schemaCmp
+	var g glue
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return err
+	}
+	root, err := compileSchema(g.Schema)
+	if err != nil {
+		return err
+	}
+	*c = schemaCmp(g)
+	c.root = root
+	return nil
+}
+
+// ------------------------------------------------------------
+// SCHEMA-NODE
+
+// schemaNode is a compiled schema. Keywords outside the supported
+// subset are ignored, as annotations would be.
+type schemaNode struct {
+	// The value of a boolean schema, or nil.
+	always *bool
+	types  []string
+	enum   []interface{}
+	// The const value, if hasConst.
+	constValue interface{}
+	hasConst   bool
+	pattern    *regexp.Regexp
+	// The numeric keywords, such as minimum, and the size keywords,
+	// such as minLength, that are present.
+	numbers map[string]json.Number
+	sizes   map[string]int
+	// Object keywords.
+	required   []string
+	properties map[string]*schemaNode
+	additional *schemaNode
+	// Array keywords.
+	items *schemaNode
+}
+
+// compileSchema() parses and compiles a schema.
+func compileSchema(data []byte) (*schemaNode, error) {
+	var v interface{}
+	err := unmarshalJson(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf(invalidSchemaFmt, err)
+	}
+	return compileSchemaNode(v, "#")
+}
+
+// compileSchemaNode() compiles the schema v, found at location at.
+func compileSchemaNode(v interface{}, at string) (*schemaNode, error) {
+	if b, ok := v.(bool); ok {
+		return &schemaNode{always: &b}, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(badSchemaFmt, at, "want object or boolean")
+	}
+	n := &schemaNode{}
+	for _, k := range sortedKeys(m) {
+		kv, kat := m[k], joinPointer(at, k)
+		var err error
+		switch k {
+		case "type":
+			n.types, err = compileSchemaTypes(kv)
+		case "enum":
+			var ok bool
+			if n.enum, ok = kv.([]interface{}); !ok {
+				err = fmt.Errorf("want array")
+			}
+		case "const":
+			n.constValue, n.hasConst = kv, true
+		case "pattern":
+			s, ok := kv.(string)
+			if !ok {
+				err = fmt.Errorf(wantStringFmt)
+				break
+			}
+			n.pattern, err = regexp.Compile(s)
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			num, ok := kv.(json.Number)
+			if !ok {
+				err = fmt.Errorf(wantNumberFmt)
+				break
+			}
+			if n.numbers == nil {
+				n.numbers = make(map[string]json.Number)
+			}
+			n.numbers[k] = num
+		case "minLength", "maxLength", "minItems", "maxItems":
+			i, ok := toSize(kv)
+			if !ok {
+				err = fmt.Errorf("want non-negative integer")
+				break
+			}
+			if n.sizes == nil {
+				n.sizes = make(map[string]int)
+			}
+			n.sizes[k] = i
+		case "required":
+			n.required, err = toStrings(kv)
+		case "properties":
+			props, ok := kv.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("want object")
+				break
+			}
+			n.properties = make(map[string]*schemaNode, len(props))
+			for name, pv := range props {
+				n.properties[name], err = compileSchemaNode(pv, joinPointer(kat, name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "additionalProperties":
+			if n.additional, err = compileSchemaNode(kv, kat); err != nil {
+				return nil, err
+			}
+		case "items":
+			if n.items, err = compileSchemaNode(kv, kat); err != nil {
+				return nil, err
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf(badSchemaFmt, kat, err)
+		}
+	}
+	return n, nil
+}
+
+// compileSchemaTypes() answers the names in a type keyword.
+func compileSchemaTypes(v interface{}) ([]string, error) {
+	if s, ok := v.(string); ok {
+		v = []interface{}{s}
+	}
+	types, err := toStrings(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("unknown type %v", t)
+		}
+	}
+	return types, nil
+}
+
+// validate() records a mismatch in s for each way v, found at
+// path, violates the schema.
+func (n *schemaNode) validate(s *cmpState, path string, v interface{}) {
+	if n.always != nil {
+		if !*n.always {
+			s.fail(newSchemaError(path, false, v, falseSchemaMsg))
+		}
+		return
+	}
+	if len(n.types) > 0 && !n.matchesType(v) {
+		want := strings.Join(n.types, " or ")
+		s.fail(newSchemaError(path, n.types, v, fmt.Sprintf("want type %v", want)))
+	}
+	if n.enum != nil && !containsValue(n.enum, v) {
+		s.fail(newSchemaError(path, n.enum, v, fmt.Sprintf("want one of %v", toJson(n.enum))))
+	}
+	if n.hasConst && !equalValues(n.constValue, v) {
+		s.fail(newSchemaError(path, n.constValue, v, fmt.Sprintf("want const %v", toJson(n.constValue))))
+	}
+	switch t := v.(type) {
+	case string:
+		n.validateSize(s, path, v, "minLength", "maxLength", utf8.RuneCountInString(t))
+		if n.pattern != nil && !n.pattern.MatchString(t) {
+			s.fail(newSchemaError(path, n.pattern.String(), v, fmt.Sprintf("want match for %v", n.pattern)))
+		}
+	case json.Number:
+		n.validateNumber(s, path, t)
+	case []interface{}:
+		n.validateSize(s, path, v, "minItems", "maxItems", len(t))
+		if n.items != nil {
+			for i, item := range t {
+				n.items.validate(s, joinPointer(path, fmt.Sprintf("%v", i)), item)
+			}
+		}
+	case map[string]interface{}:
+		n.validateObject(s, path, t)
+	}
+}
+
+// validateNumber() checks the numeric keywords. Integers are
+// compared exactly, at any size.
+func (n *schemaNode) validateNumber(s *cmpState, path string, v json.Number) {
+	for _, k := range numberKeywords {
+		limit, ok := n.numbers[k]
+		if !ok {
+			continue
+		}
+		order, ok := orderNumbers(v, limit)
+		if !ok {
+			continue
+		}
+		var pass bool
+		switch k {
+		case "minimum":
+			pass = order >= 0
+		case "maximum":
+			pass = order <= 0
+		case "exclusiveMinimum":
+			pass = order > 0
+		default:
+			pass = order < 0
+		}
+		if !pass {
+			s.fail(newSchemaError(path, limit, v, fmt.Sprintf("want %v %v", k, limit)))
+		}
+	}
+}
+
+// validateSize() checks a pair of size keywords against size.
+func (n *schemaNode) validateSize(s *cmpState, path string, v interface{}, minKey, maxKey string, size int) {
+	if limit, ok := n.sizes[minKey]; ok && size < limit {
+		s.fail(newSchemaError(path, limit, v, fmt.Sprintf("want %v %v", minKey, limit)))
+	}
+	if limit, ok := n.sizes[maxKey]; ok && size > limit {
+		s.fail(newSchemaError(path, limit, v, fmt.Sprintf("want %v %v", maxKey, limit)))
+	}
+}
+
+// validateObject() checks the object keywords.
+func (n *schemaNode) validateObject(s *cmpState, path string, v map[string]interface{}) {
+	for _, name := range n.required {
+		if _, ok := v[name]; !ok {
+			e := newSchemaError(joinPointer(path, name), n.required, nil, "required")
+			e.s = requiredMsg
+			s.fail(e)
+		}
+	}
+	for _, k := range sortedKeys(v) {
+		if p, ok := n.properties[k]; ok {
+			p.validate(s, joinPointer(path, k), v[k])
+		} else if n.additional != nil {
+			if n.additional.always != nil && !*n.additional.always {
+				s.fail(newSchemaError(joinPointer(path, k), false, v[k], "want no additional properties"))
+				continue
+			}
+			n.additional.validate(s, joinPointer(path, k), v[k])
+		}
+	}
+}
+
+// matchesType() answers true if v is one of the types.
+func (n *schemaNode) matchesType(v interface{}) bool {
+	for _, t := range n.types {
+		switch t {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(json.Number); ok {
+				return true
+			}
+		case "integer":
+			if num, ok := v.(json.Number); ok && isInteger(num) {
+				return true
+			}
+		default:
+			if jsonTypeOf(v) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newSchemaError() answers a new comparison error for a
+// schema violation.
+func newSchemaError(path string, want, have interface{}, detail string) *ComparisonError {
+	e := newMismatchError(path, ReasonSchema, want, have)
+	e.detail = detail
+	return e
+}
+
+// ------------------------------------------------------------
+// FUNCS
+
+// containsValue() answers true if v equals any of the values.
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, e := range values {
+		if equalValues(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInteger() answers true if n has no fractional part, so 1.0
+// counts as an integer.
+func isInteger(n json.Number) bool {
+	f, ok := new(big.Float).SetString(string(n))
+	return ok && f.IsInt()
+}
+
+// toSize() answers a generic number as a non-negative int.
+func toSize(v interface{}) (int, bool) {
+	n, ok := v.(json.Number)
+	if !ok || !isInteger(n) {
+		return 0, false
+	}
+	f, _ := toFloat(n)
+	if f < 0 || f > float64(maxSchemaSize) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// toStrings() answers a generic array of strings, sorted.
+func toStrings(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want array of strings")
+	}
+	ans := make([]string, 0, len(list))
+	for _, e := range list {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("want array of strings")
+		}
+		ans = append(ans, s)
+	}
+	sort.Strings(ans)
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	schemaCmpFactoryKey = "jacl-schemacmp"
+	maxSchemaSize       = 1<<31 - 1
+)
+
+const (
+	invalidSchemaFmt = "jacl: invalid schema: %w"
+	badSchemaFmt     = "jacl: bad schema at %v: %v"
+	falseSchemaMsg   = "want nothing, the schema is false"
+	requiredMsg      = "missing, required by schema"
+)
+
+var (
+	numberKeywords = []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"}
+)
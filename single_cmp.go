@@ -1,7 +1,9 @@
 package jacl
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"strings"
 )
 
 // ------------------------------------------------------------
@@ -9,59 +11,131 @@ import (
 
 // singleCmp compares a single item to another.
 type singleCmp struct {
-	A interface{} `json:"a,omitempty"`
+	A    interface{}   `json:"a,omitempty"`
+	Fn   []FuncFactory `json:"fn,omitempty"`
+	Opts cmpOpts       `json:"opts,omitempty"`
 }
 
 func (c singleCmp) Cmp(b interface{}) error {
+	return cmpOutermost(c, b)
+}
+
+func (c singleCmp) cmpScoped(_b interface{}, sc *varScope) error {
+	if c.Opts.vars != nil {
+		sc.vars = c.Opts.vars
+	}
+	s := newCmpState(c.Opts)
+	s.scope = sc
+	w := newWalker(c.Opts)
+	a, err := w.root(c.A)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	b, err := w.root(_b)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	s.setRoot(a, b)
+	for _, fn := range c.Fn {
+		err = c.evalFn(fn, b)
+		if err != nil {
+			cont, everr := s.failErr(err)
+			if everr != nil {
+				return everr
+			} else if !cont {
+				return s.err()
+			}
+		}
+	}
+	// As with Cmps(), functions without data are the whole comparison.
+	if len(c.Fn) > 0 && c.A == nil {
+		return s.err()
+	}
+
+	// Handle matchers.
+	if _, ok, _ := asMatcher(a); ok {
+		s.compare("", a, b)
+		return s.err()
+	}
+
 	// Handle simple comparisons.
-	ans, err := compareBasicTypes(c.A, b)
+	ans, err := compareBasicTypes(a, b)
 	if err == nil {
 		if ans {
 			return nil
 		}
-		return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(b), toJson(c.A)))
+		s.fail(newMismatchError("", ReasonValue, a, b))
+		return s.err()
 	}
 
 	// Handle slice comparisons.
-	handled, err := c.cmpAsSlices(c.A, b)
-	if handled {
-		return err
+	if c.cmpAsSlices(s, a, b) {
+		return s.err()
 	}
 
-	// Handle map comparisons.
-	amap := make(map[string]interface{})
-	bmap := make(map[string]interface{})
-	err = toFromJson(c.A, &amap, b, &bmap)
-	if err != nil {
-		return newEvaluationError(err)
+	// Handle map comparisons. Anything else is compared as-is.
+	amap, aok := a.(map[string]interface{})
+	bmap, bok := b.(map[string]interface{})
+	if !aok || (!bok && b != nil) {
+		s.compare("", a, b)
+		return s.err()
 	}
-	for k, av := range amap {
-		if !compare(av, bmap[k]) {
-			return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(b), toJson(c.A)))
+	for _, k := range sortedKeys(amap) {
+		bv, ok := bmap[k]
+		if !s.compareMember(joinKey("", k), amap[k], bv, ok) && !c.Opts.All {
+			break
 		}
 	}
-	return nil
+	if len(s.errs) < 1 || c.Opts.All {
+		s.compareExtraKeys("", amap, bmap)
+	}
+	return s.err()
 }
 
 func (c singleCmp) SerializeKey() string {
 	return singleCmpFactoryKey
 }
 
-func (c singleCmp) cmpAsSlices(_a, _b interface{}) (bool, error) {
-	// Need to encode/decode the data to eliminate variations in slice type
-	var aslice []interface{}
-	var bslice []interface{}
-	err := toFromJson(_a, &aslice, _b, &bslice)
+// MarshalJSON() normalizes A with the comparison options, so the
+// serialized expectation keeps the fields they require.
+func (c singleCmp) MarshalJSON() ([]byte, error) {
+	type glue singleCmp
+	a, err := newWalker(c.Opts).root(c.A)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	if len(aslice) != len(bslice) {
-		return true, newComparisonError(fmt.Sprintf(haveWantLengthFmt, len(bslice), len(aslice)))
+	c.A = a
+	return json.Marshal(glue(c))
+}
+
+// evalFn() runs fn against b. A list is evaluated as Cmps() would,
+// anything else as a list of one item, with the paths of any
+// mismatches made relative to b.
+func (c singleCmp) evalFn(fn FuncFactory, b interface{}) error {
+	if bslice, ok := b.([]interface{}); ok {
+		return fn.Eval(bslice)
 	}
-	for i, ai := range aslice {
-		if !compare(ai, bslice[i]) {
-			return true, newComparisonError(fmt.Sprintf(haveWantFmt, toJson(bslice), toJson(aslice)))
-		}
+	err := fn.Eval([]interface{}{b})
+	var ce *ComparisonError
+	if !errors.As(err, &ce) {
+		return err
+	}
+	return ce.withPathFunc(func(path string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(path, "[0]"), ".")
+	})
+}
+
+// cmpAsSlices() compares a and b if a is a slice and b is a slice
+// or null, answering true if it did.
+func (c singleCmp) cmpAsSlices(s *cmpState, a, b interface{}) bool {
+	aslice, ok := a.([]interface{})
+	if !ok {
+		return false
+	}
+	bslice, ok := b.([]interface{})
+	if !ok && b != nil {
+		return false
 	}
-	return true, nil
+	s.compareInterfaceSlice("", aslice, bslice)
+	return true
 }
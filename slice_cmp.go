@@ -1,7 +1,9 @@
 package jacl
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // ------------------------------------------------------------
@@ -15,45 +17,94 @@ type sliceCmp struct {
 	Keys []string      `json:"key,omitempty"`
 	A    []interface{} `json:"a,omitempty"`
 	Fn   []FuncFactory `json:"fn,omitempty"`
+	Opts cmpOpts       `json:"opts,omitempty"`
 }
 
 func (c sliceCmp) Cmp(b interface{}) error {
-	if c.A == nil && b == nil {
-		return nil
+	return cmpOutermost(c, b)
+}
+
+func (c sliceCmp) cmpScoped(_b interface{}, sc *varScope) error {
+	if c.Opts.vars != nil {
+		sc.vars = c.Opts.vars
 	}
-	bslice := make([]interface{}, 0)
-	err := toFromJson(b, &bslice)
+	w := newWalker(c.Opts)
+	bslice, err := w.rootSlice(_b)
 	if err != nil {
 		return newEvaluationError(err)
 	}
+	if c.A == nil && bslice == nil {
+		return nil
+	}
 
+	s := newCmpState(c.Opts)
+	s.scope = sc
+	aslice, err := w.rootSlice(c.A)
+	if err != nil {
+		return newEvaluationError(err)
+	}
+	if aslice == nil {
+		aslice = make([]interface{}, 0)
+	}
+	if bslice == nil {
+		bslice = make([]interface{}, 0)
+	}
+	s.setRoot(aslice, bslice)
 	for _, fn := range c.Fn {
 		err = fn.Eval(bslice)
 		if err != nil {
-			return newEvaluationError(err)
+			cont, everr := s.failErr(err)
+			if everr != nil {
+				return everr
+			} else if !cont {
+				return s.err()
+			}
 		}
 	}
 	// If we have functions but no data, we don't
 	// perform a comparison. This handles the case where
 	// the comparison is nothing but not-exists checks.
 	if len(c.Fn) > 0 && len(c.A) < 1 {
-		return nil
+		return s.err()
 	}
 
-	asrc, bsrc, err := c.convertToStringMaps(bslice)
+	// Unordered comparisons match by content, which works
+	// the same for string maps and literals.
+	if c.Opts.Unordered && len(c.Keys) < 1 {
+		s.compareUnordered("", aslice, bslice, true)
+		return s.err()
+	}
+
+	asrc, bsrc, err := c.convertToStringMaps(aslice, bslice)
 	if err == nil {
-		return c.cmpStringMaps(asrc, bsrc)
+		c.cmpStringMaps(s, asrc, bsrc)
+		return s.err()
 	}
 
 	// If I couldn't convert to string maps, assume the slices
 	// contain literals.
-	return c.cmpSlices(c.A, bslice)
+	c.cmpSlices(s, aslice, bslice)
+	return s.err()
 }
 
 func (c sliceCmp) SerializeKey() string {
 	return sliceCmpFactoryKey
 }
 
+// MarshalJSON() normalizes A with the comparison options, so the
+// serialized expectation keeps the fields they require.
+func (c sliceCmp) MarshalJSON() ([]byte, error) {
+	type glue sliceCmp
+	if c.A != nil {
+		a, err := newWalker(c.Opts).rootSlice(c.A)
+		if err != nil {
+			return nil, err
+		}
+		c.A = a
+	}
+	return json.Marshal(glue(c))
+}
+
 func (c sliceCmp) addFn(_fn interface{}) sliceCmp {
 	if fn, ok := _fn.(CmpsFunc); ok {
 		c.Fn = append(c.Fn, FuncFactory{Fn: fn})
@@ -62,74 +113,138 @@ func (c sliceCmp) addFn(_fn interface{}) sliceCmp {
 	panic("unknown func")
 }
 
-func (c sliceCmp) cmpStringMaps(asrc, bsrc []map[string]interface{}) error {
+func (c sliceCmp) cmpStringMaps(s *cmpState, asrc, bsrc []map[string]interface{}) bool {
+	ans := true
+	keys := make([][]string, 0, len(c.Keys))
+	for _, k := range c.Keys {
+		keys = append(keys, splitKeyPath(k))
+	}
+	// Pair every item first, so a diff shows each in place.
+	founds := make([][]int, len(asrc))
+	pairs := make([]int, len(asrc))
 	for i, av := range asrc {
-		bv := c.find(c.Keys, i, av, bsrc)
-		if bv == nil {
-			return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(bsrc), toJson(asrc)))
+		founds[i] = c.find(s, keys, i, av, bsrc)
+		pairs[i] = -1
+		if len(founds[i]) == 1 {
+			pairs[i] = founds[i][0]
 		}
-		if !compare(av, bv) {
-			return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(bsrc), toJson(asrc)))
+	}
+	s.setPairs("", pairs)
+	used := make([]bool, len(bsrc))
+	for i, av := range asrc {
+		found := founds[i]
+		for _, bi := range found {
+			used[bi] = true
+		}
+		if len(found) < 1 {
+			ans = false
+			if !s.fail(newMismatchError(joinIndex("", i), ReasonMissing, av, nil)) {
+				return false
+			}
+		} else if len(found) > 1 {
+			ans = false
+			if !s.fail(c.newAmbiguousError(i, av, found)) {
+				return false
+			}
+		} else if bi := found[0]; !s.compare(joinIndex("", bi), av, bsrc[bi]) {
+			ans = false
+			if !s.opts.All {
+				return false
+			}
 		}
 	}
-	return nil
+	return s.compareExtraItems("", toInterfaceSlice(bsrc), used) && ans
 }
 
-func (c sliceCmp) cmpSlices(aslice, bslice []interface{}) error {
-	if len(aslice) != len(bslice) {
-		return newComparisonError(fmt.Sprintf(haveWantLengthFmt, len(bslice), len(aslice)))
-	}
-	for i, av := range aslice {
-		if !compare(av, bslice[i]) {
-			return newComparisonError(fmt.Sprintf(haveWantFmt, toJson(bslice), toJson(aslice)))
-		}
-	}
-	return nil
+func (c sliceCmp) cmpSlices(s *cmpState, aslice, bslice []interface{}) bool {
+	return s.compareInterfaceSlice("", aslice, bslice)
 }
 
-func (c sliceCmp) find(keys []string, index int, avalues map[string]interface{}, bvalues []map[string]interface{}) map[string]interface{} {
+// find() answers the indexes of the items in bvalues that
+// correspond to avalues. Without keys, this is the item at the
+// same index. With keys, it is every item with matching keys,
+// so more than one answer means the keys are ambiguous.
+func (c sliceCmp) find(s *cmpState, keys [][]string, index int, avalues map[string]interface{}, bvalues []map[string]interface{}) []int {
 	if len(keys) < 1 {
 		if index < 0 || index >= len(bvalues) {
 			return nil
 		}
-		return bvalues[index]
-	} else {
-		for _, bv := range bvalues {
-			if c.matches(keys, avalues, bv) {
-				return bv
-			}
+		return []int{index}
+	}
+	var ans []int
+	for i, bv := range bvalues {
+		if c.matches(s, keys, avalues, bv) {
+			ans = append(ans, i)
 		}
 	}
-	return nil
+	return ans
 }
 
-func (c sliceCmp) matches(keys []string, avalues map[string]interface{}, bvalues map[string]interface{}) bool {
-	for _, key := range keys {
-		if avalues[key] != bvalues[key] {
+// matches() answers true if every key in avalues compares
+// equal to the same key in bvalues. A key missing from both
+// matches.
+func (c sliceCmp) matches(s *cmpState, keys [][]string, avalues map[string]interface{}, bvalues map[string]interface{}) bool {
+	for i, key := range keys {
+		av, aok := lookupKey(avalues, c.Keys[i], key)
+		bv, bok := lookupKey(bvalues, c.Keys[i], key)
+		if aok != bok || (aok && !s.probeKey(av, bv)) {
 			return false
 		}
 	}
 	return true
 }
 
-func (c sliceCmp) convertToStringMaps(b []interface{}) ([]map[string]interface{}, []map[string]interface{}, error) {
-	asrc := make([]map[string]interface{}, 0)
-	bsrc := make([]map[string]interface{}, 0)
-	for _, av := range c.A {
-		amap := make(map[string]interface{})
-		err := toFromJson(av, &amap)
-		if err != nil {
-			return nil, nil, err
+// newAmbiguousError() answers the error for the A item at index,
+// whose keys match every B item in found.
+func (c sliceCmp) newAmbiguousError(index int, avalues map[string]interface{}, found []int) *ComparisonError {
+	want := make(map[string]interface{})
+	for _, k := range c.Keys {
+		if v, ok := lookupKey(avalues, k, splitKeyPath(k)); ok {
+			want[k] = v
 		}
-		asrc = append(asrc, amap)
 	}
-	for _, bv := range b {
-		bmap := make(map[string]interface{})
-		err := toFromJson(bv, &bmap)
-		if err != nil {
-			return nil, nil, err
-		}
-		bsrc = append(bsrc, bmap)
+	paths := make([]string, 0, len(found))
+	for _, bi := range found {
+		paths = append(paths, joinIndex("", bi))
+	}
+	err := newMismatchError(joinIndex("", index), ReasonAmbiguous, want, nil)
+	err.detail = strings.Join(paths, ", ")
+	return err
+}
+
+// convertToStringMaps() answers the normalized slices as maps, or
+// an error if any item is not an object.
+func (c sliceCmp) convertToStringMaps(a, b []interface{}) ([]map[string]interface{}, []map[string]interface{}, error) {
+	asrc, err := toStringMaps(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	bsrc, err := toStringMaps(b)
+	if err != nil {
+		return nil, nil, err
 	}
 	return asrc, bsrc, nil
 }
+
+func toStringMaps(src []interface{}) ([]map[string]interface{}, error) {
+	dst := make([]map[string]interface{}, 0, len(src))
+	for _, v := range src {
+		switch t := v.(type) {
+		case nil:
+			dst = append(dst, map[string]interface{}{})
+		case map[string]interface{}:
+			dst = append(dst, t)
+		default:
+			return nil, fmt.Errorf(normalizeKindFmt, jsonTypeOf(v), TypeObject)
+		}
+	}
+	return dst, nil
+}
+
+func toInterfaceSlice(src []map[string]interface{}) []interface{} {
+	dst := make([]interface{}, 0, len(src))
+	for _, m := range src {
+		dst = append(dst, m)
+	}
+	return dst
+}
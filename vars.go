@@ -0,0 +1,267 @@
+package jacl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// VARS
+
+// Vars holds values captured from B by Capture(), so later
+// comparisons can require them with Ref(). Pass a Vars to Cmp()
+// or Cmps() as an option. Captures are only stored once the whole
+// comparison passes, which includes any All(), AnyOf(), Not(), At()
+// or HTTP() the comparison is inside of. A Vars is safe for
+// concurrent use.
+//
+// Vars are not serialized with a comparison, so they must be
+// passed again to a comparison that has been unmarshalled.
+type Vars struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// NewVars answers a new, empty Vars.
+func NewVars() *Vars {
+	return &Vars{values: make(map[string]interface{})}
+}
+
+// Get answers the value stored under name, and true if there is one.
+// Captured values are generic JSON values: nil, bool, json.Number,
+// string, []interface{} or map[string]interface{}.
+func (v *Vars) Get(name string) (interface{}, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Set stores value under name, replacing anything there.
+func (v *Vars) Set(name string, value interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.values == nil {
+		v.values = make(map[string]interface{})
+	}
+	v.values[name] = value
+}
+
+// Names answers the name of each stored value, in sorted order.
+func (v *Vars) Names() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := make([]string, 0, len(v.values))
+	for k := range v.values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (v *Vars) applyTo(opts *cmpOpts) {
+	opts.vars = v
+}
+
+// ------------------------------------------------------------
+// VAR-SCOPE
+
+// varScope holds the values captured during a comparison. Only the
+// outermost comparison stores them in the Vars, and only if it
+// passes; nested comparisons and probes work in a fork, which is
+// merged back if its result is kept.
+type varScope struct {
+	vars    *Vars
+	pending []capturedVar
+	// The number of pending captures inherited from the parent.
+	base int
+}
+
+// capturedVar is a value waiting to be stored.
+type capturedVar struct {
+	vars  *Vars
+	name  string
+	value interface{}
+}
+
+func newVarScope(vars *Vars) *varScope {
+	return &varScope{vars: vars}
+}
+
+// lookup() answers the value for name, preferring a value captured
+// earlier in this comparison.
+func (sc *varScope) lookup(name string) (interface{}, bool) {
+	for i := len(sc.pending) - 1; i >= 0; i-- {
+		if e := sc.pending[i]; e.vars == sc.vars && e.name == name {
+			return e.value, true
+		}
+	}
+	if sc.vars == nil {
+		return nil, false
+	}
+	return sc.vars.Get(name)
+}
+
+// capture() holds value under name until commit().
+func (sc *varScope) capture(name string, value interface{}) {
+	sc.pending = append(sc.pending, capturedVar{sc.vars, name, value})
+}
+
+// fork() answers a scope that sees the captures so far. Its own
+// captures are discarded unless it is merged.
+func (sc *varScope) fork() *varScope {
+	n := len(sc.pending)
+	return &varScope{vars: sc.vars, pending: sc.pending[:n:n], base: n}
+}
+
+// merge() keeps the captures made in a fork of the receiver.
+func (sc *varScope) merge(f *varScope) {
+	sc.pending = append(sc.pending, f.pending[f.base:]...)
+}
+
+// captured() answers true if the scope made its own captures.
+func (sc *varScope) captured() bool {
+	return len(sc.pending) > sc.base
+}
+
+// commit() stores the captures in the Vars.
+func (sc *varScope) commit() {
+	for _, e := range sc.pending {
+		if e.vars != nil {
+			e.vars.Set(e.name, e.value)
+		}
+	}
+	sc.pending = nil
+}
+
+// ------------------------------------------------------------
+// SCOPED-CMPER
+
+// scopedCmper is a Cmper that can run inside another comparison,
+// recording captures in the caller's scope instead of storing them.
+// The scope is a fork owned by the call, so the Cmper can set the
+// Vars it captures into.
+type scopedCmper interface {
+	Cmper
+	cmpScoped(b interface{}, sc *varScope) error
+}
+
+// cmpScoped() runs c inside the comparison that owns sc, keeping
+// its captures only if it passes.
+func cmpScoped(c Cmper, b interface{}, sc *varScope) error {
+	scd, ok := c.(scopedCmper)
+	if !ok {
+		return c.Cmp(b)
+	}
+	f := sc.fork()
+	err := scd.cmpScoped(b, f)
+	if err == nil {
+		sc.merge(f)
+	}
+	return err
+}
+
+// cmpOutermost() runs c as the outermost comparison, storing its
+// captures if it passes.
+func cmpOutermost(c scopedCmper, b interface{}) error {
+	sc := newVarScope(nil)
+	err := c.cmpScoped(b, sc)
+	if err == nil {
+		sc.commit()
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// VARS-MATCHER
+
+// varsMatcher is a Matcher that reads or writes the Vars of a
+// comparison. Outside a comparison with Vars it fails.
+type varsMatcher interface {
+	Matcher
+	matchVars(v interface{}, sc *varScope) error
+}
+
+// ------------------------------------------------------------
+// CAPTURE-MATCHER
+
+// captureMatcher matches any value, recording it under Name.
+type captureMatcher struct {
+	Name string `json:"name"`
+}
+
+func (m captureMatcher) Match(v interface{}) error {
+	return fmt.Errorf(noVarsFmt, "capture", m.Name)
+}
+
+func (m captureMatcher) matchVars(v interface{}, sc *varScope) error {
+	if sc.vars == nil {
+		return m.Match(v)
+	}
+	sc.capture(m.Name, v)
+	return nil
+}
+
+func (m captureMatcher) FactoryKey() string {
+	return captureMatcherKey
+}
+
+func (m captureMatcher) MarshalJSON() ([]byte, error) {
+	type glue captureMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// REF-MATCHER
+
+// refMatcher matches the value recorded under Name.
+type refMatcher struct {
+	Name string `json:"name"`
+}
+
+func (m refMatcher) Match(v interface{}) error {
+	return fmt.Errorf(noVarsFmt, "ref", m.Name)
+}
+
+func (m refMatcher) matchVars(v interface{}, sc *varScope) error {
+	if sc.vars == nil {
+		return m.Match(v)
+	}
+	want, ok := sc.lookup(m.Name)
+	if !ok {
+		return fmt.Errorf(noCaptureFmt, m.Name)
+	}
+	want, err := normalize(want)
+	if err != nil {
+		return err
+	}
+	// Captures are compared for equality, not containment.
+	if !equalValues(want, v) {
+		return fmt.Errorf(refMismatchFmt, m.Name, toJson(want))
+	}
+	return nil
+}
+
+func (m refMatcher) FactoryKey() string {
+	return refMatcherKey
+}
+
+func (m refMatcher) MarshalJSON() ([]byte, error) {
+	type glue refMatcher
+	return MarshalMatcher(m.FactoryKey(), glue(m))
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	captureMatcherKey = "jacl-capture"
+	refMatcherKey     = "jacl-ref"
+)
+
+const (
+	noVarsFmt      = "%v %v requires Vars"
+	noCaptureFmt   = "nothing captured for %v"
+	refMismatchFmt = "want %v = %v"
+)